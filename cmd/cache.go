@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"kasher/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+var pruneDryRun bool
+var pruneOrphaned bool
+var pruneExpired bool
+var pruneMaxSize string
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage kasher's cached output",
+}
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove orphaned, expired or oversized cache entries",
+	Long: `Remove cache entries that are no longer useful:
+
+  orphaned   the task was deleted, or its project task file no longer defines it,
+             or the history of an entry that is gone
+  expired    the entry expired and is past its staleWhileRevalidate and staleIfError
+             windows; entries of tasks with keepLastGood are kept
+  oversized  the entry is larger than --max-size
+
+Without --orphaned, --expired or --max-size, orphaned and expired entries are removed.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var maxSize int64
+		if pruneMaxSize != "" {
+			var err error
+			if maxSize, err = config.ParseSize(pruneMaxSize); err != nil {
+				return err
+			}
+		}
+		orphaned, expired := pruneOrphaned, pruneExpired
+		if !orphaned && !expired && maxSize == 0 {
+			orphaned, expired = true, true
+		}
+
+		files, err := config.ListCacheFiles()
+		if err != nil {
+			return err
+		}
+		owners, err := config.NewCacheOwners()
+		if err != nil {
+			return err
+		}
+		sort.Slice(files, func(i, j int) bool { return files[i].Key < files[j].Key })
+
+		now := time.Now()
+		var removed int
+		var reclaimed int64
+		for _, file := range files {
+			reason := ""
+			task, owned := owners.Owner(file)
+			switch {
+			case orphaned && !owned:
+				reason = "orphaned"
+			case expired && owned && isPrunablyExpired(task, file, now):
+				reason = "expired"
+			case maxSize > 0 && file.Size > maxSize:
+				reason = "oversized"
+			}
+			if reason == "" {
+				continue
+			}
+			if !pruneDryRun {
+				if err := removeCacheFile(file); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: Failed to remove %s: %v\n", file.Path, err)
+					continue
+				}
+			}
+			size := file.Size + file.HistorySize
+			fmt.Printf("%s (%s, %s)\n", file.Key, reason, formatBytes(size))
+			removed++
+			reclaimed += size
+		}
+
+		// History left behind by cache entries removed without it belongs to no entry
+		if orphaned {
+			keys, err := config.OrphanedHistoryKeys()
+			if err != nil {
+				return err
+			}
+			for _, key := range keys {
+				size := config.HistorySize(key)
+				if !pruneDryRun {
+					if err := removeHistory(key); err != nil {
+						fmt.Fprintf(os.Stderr, "Warning: Failed to remove the history of %s: %v\n", key, err)
+						continue
+					}
+				}
+				fmt.Printf("%s (orphaned history, %s)\n", key, formatBytes(size))
+				removed++
+				reclaimed += size
+			}
+		}
+
+		if pruneDryRun {
+			fmt.Printf("Would remove %d cache entries, reclaiming %s.\n", removed, formatBytes(reclaimed))
+		} else {
+			fmt.Printf("Removed %d cache entries, reclaimed %s.\n", removed, formatBytes(reclaimed))
+		}
+		return nil
+	},
+}
+
+func init() {
+	cacheCmd.AddCommand(pruneCmd)
+	pruneCmd.Flags().BoolVar(&pruneDryRun, "dry-run", false, "Show what would be removed without removing anything")
+	pruneCmd.Flags().BoolVar(&pruneOrphaned, "orphaned", false, "Remove entries of tasks that no longer exist")
+	pruneCmd.Flags().BoolVar(&pruneExpired, "expired", false, "Remove expired entries that can no longer be served")
+	pruneCmd.Flags().StringVar(&pruneMaxSize, "max-size", "", "Remove entries larger than this size (e.g. 10MB)")
+}
+
+// isPrunablyExpired reports whether a cache entry has expired and can no longer be
+// served in place of a fresh result, so removing it loses nothing.
+func isPrunablyExpired(task config.TaskConfig, file config.CacheFile, now time.Time) bool {
+	if task.KeepLastGood {
+		return false
+	}
+	expiresAt, ok := task.ExpiresAt(file.Timestamp)
+	if !ok {
+		return false
+	}
+	grace := max(task.StaleWhileRevalidateWindow(), task.StaleIfErrorWindow())
+	return now.After(expiresAt.Add(grace))
+}
+
+// removeCacheFile deletes a cache entry and its history unless a kasher process is
+// refreshing it.
+func removeCacheFile(file config.CacheFile) error {
+	lock, err := config.TryLockTask(file.Key)
+	if err != nil {
+		return err
+	}
+	if lock == nil {
+		return errors.New("the task is running")
+	}
+	defer lock.Unlock()
+	if err := os.Remove(file.Path); err != nil {
+		return err
+	}
+	return config.RemoveHistory(file.Key)
+}
+
+// removeHistory deletes the history of a cache key unless a kasher process is
+// refreshing it.
+func removeHistory(key string) error {
+	lock, err := config.TryLockTask(key)
+	if err != nil {
+		return err
+	}
+	if lock == nil {
+		return errors.New("the task is running")
+	}
+	defer lock.Unlock()
+	return config.RemoveHistory(key)
+}
@@ -0,0 +1,336 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"kasher/internal/config"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/spf13/cobra"
+)
+
+var editCmd = &cobra.Command{
+	Use:   "edit [name]",
+	Short: "Edit a task, or the whole config, in your editor",
+	Long: `Open a task's settings as TOML in $VISUAL or $EDITOR (vi if neither is set).
+Without a name the whole global config is opened, so tasks can also be added,
+renamed or removed. Renamed tasks keep their cache and run statistics, as long as
+their settings are left as they are; removed tasks lose theirs. The result is
+checked before it is saved; if it is invalid the editor is opened again with the
+error at the top of the file.`,
+	Args: cobra.RangeArgs(0, 1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if verbose {
+			printVerboseInfo()
+		}
+		if len(args) == 0 {
+			return editConfig()
+		}
+		return editTask(args[0])
+	},
+}
+
+// editTask edits the settings of a single global task.
+func editTask(taskName string) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+	existing, exists := cfg[taskName]
+	if !exists {
+		return fmt.Errorf("task '%s' does not exist", taskName)
+	}
+	if existing.IsProjectTask() {
+		return projectTaskError(taskName, existing)
+	}
+
+	original := taskTOML(existing) + "\n"
+	var task config.TaskConfig
+	edited, err := editUntilValid(fmt.Sprintf("task '%s'", taskName), original, func(data []byte) error {
+		task = config.TaskConfig{}
+		if err := decodeStrict(data, &task); err != nil {
+			return err
+		}
+		return validateEditedTask(taskName, task)
+	})
+	if err != nil || !edited {
+		return err
+	}
+
+	err = config.UpdateConfig(func(cfg config.KasherConfig) error {
+		if taskTOML(cfg[taskName]) != taskTOML(existing) {
+			return fmt.Errorf("task '%s' was changed by another process while you were editing it; your changes were not saved", taskName)
+		}
+		return cfg.UpdateTask(taskName, task)
+	})
+	if err != nil {
+		return err
+	}
+	// The new details may change what the command returns, so refresh on next run
+	_ = config.UpdateTaskState(taskName, func(state *config.TaskState) {
+		state.LastFetched = time.Time{}
+	})
+	fmt.Printf("Task '%s' updated.\n", taskName)
+	return nil
+}
+
+// editConfig edits all global tasks at once.
+func editConfig() error {
+	existing, err := config.LoadGlobalConfig()
+	if err != nil {
+		return err
+	}
+	data, err := toml.Marshal(existing)
+	if err != nil {
+		return err
+	}
+	original := string(data)
+	var tasks config.KasherConfig
+	edited, err := editUntilValid("the kasher config", original, func(data []byte) error {
+		tasks = make(config.KasherConfig)
+		if err := decodeStrict(data, &tasks); err != nil {
+			return err
+		}
+		var names []string
+		for name := range tasks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := validateEditedTask(name, tasks[name]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil || !edited {
+		return err
+	}
+
+	err = config.UpdateConfig(func(cfg config.KasherConfig) error {
+		current, err := toml.Marshal(cfg)
+		if err != nil {
+			return err
+		}
+		if string(current) != original {
+			return errors.New("the config was changed by another process while you were editing it; your changes were not saved")
+		}
+		for name := range cfg {
+			delete(cfg, name)
+		}
+		for name, task := range tasks {
+			cfg[name] = task
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Renamed tasks keep their cache and state, as with 'kasher task rename'; removed
+	// tasks lose theirs, as with 'kasher task delete'
+	renamed := matchRenamedTasks(existing, tasks)
+	for oldName, newName := range renamed {
+		if err := config.MoveTaskCache(oldName, newName); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to move the cache of task '%s': %v\n", oldName, err)
+		}
+	}
+	for name := range existing {
+		if _, kept := tasks[name]; !kept && renamed[name] == "" {
+			if err := config.RemoveTaskCache(name); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Failed to remove the cache of task '%s': %v\n", name, err)
+			}
+		}
+	}
+	_ = config.UpdateState(func(state config.State) error {
+		renamedTo := make(map[string]bool, len(renamed))
+		for oldName, newName := range renamed {
+			if taskState, ok := state[oldName]; ok {
+				state[newName] = taskState
+			}
+			delete(state, oldName)
+			renamedTo[newName] = true
+		}
+		for name := range existing {
+			if _, kept := tasks[name]; !kept {
+				delete(state, name)
+			}
+		}
+		// Changed tasks refresh on their next run
+		for name, task := range tasks {
+			if !renamedTo[name] && taskTOML(task) != taskTOML(existing[name]) {
+				taskState := state[name]
+				taskState.LastFetched = time.Time{}
+				state[name] = taskState
+			}
+		}
+		return nil
+	})
+	fmt.Println("Config updated.")
+	return nil
+}
+
+// matchRenamedTasks finds the tasks that were renamed in the editor: a task that is
+// gone, and a new one with exactly the same settings. It maps old names to new names.
+// A task that is renamed and changed at once counts as removed and added.
+func matchRenamedTasks(before, after config.KasherConfig) map[string]string {
+	var removed, added []string
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	for name := range after {
+		if _, ok := before[name]; !ok {
+			added = append(added, name)
+		}
+	}
+	sort.Strings(removed)
+	sort.Strings(added)
+	renamed := make(map[string]string)
+	matched := make(map[string]bool)
+	for _, oldName := range removed {
+		for _, newName := range added {
+			if !matched[newName] && taskTOML(before[oldName]) == taskTOML(after[newName]) {
+				renamed[oldName] = newName
+				matched[newName] = true
+				break
+			}
+		}
+	}
+	return renamed
+}
+
+// validateEditedTask checks a task written in the editor or imported from a file
+// against the rules tasks created with prompts or flags follow.
+func validateEditedTask(name string, task config.TaskConfig) error {
+	switch {
+	case strings.TrimSpace(name) == "":
+		return errors.New("task name cannot be empty")
+	case isReservedTaskName(name):
+		return fmt.Errorf("the name '%s' is reserved and cannot be used", name)
+	case strings.Contains(name, " "):
+		return fmt.Errorf("task name '%s' must not contain spaces", name)
+	case task.Expiration == "":
+		return fmt.Errorf("task '%s': expiration is required", name)
+	}
+	if err := task.Validate(); err != nil {
+		return fmt.Errorf("task '%s': %w", name, err)
+	}
+	return nil
+}
+
+// decodeStrict decodes TOML, rejecting settings kasher doesn't know so typos
+// don't go unnoticed. Syntax errors quote the offending line.
+func decodeStrict(data []byte, v any) error {
+	decoder := toml.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		var strictErr *toml.StrictMissingError
+		if errors.As(err, &strictErr) {
+			var keys []string
+			for _, keyErr := range strictErr.Errors {
+				keys = append(keys, strings.Join(keyErr.Key(), "."))
+			}
+			return fmt.Errorf("unknown setting %s", strings.Join(keys, ", "))
+		}
+		var decodeErr *toml.DecodeError
+		if errors.As(err, &decodeErr) {
+			row, _ := decodeErr.Position()
+			lines := strings.Split(string(data), "\n")
+			if row >= 1 && row <= len(lines) {
+				return fmt.Errorf("%s, in line %q", decodeErr.Error(), strings.TrimSpace(lines[row-1]))
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// editUntilValid opens content in the user's editor until check accepts the result.
+// Each time check fails, the editor is opened again with the error in a comment at
+// the top of the file. It reports false if the user saved the content unchanged or
+// emptied the file to cancel.
+func editUntilValid(subject, content string, check func(data []byte) error) (bool, error) {
+	file, err := os.CreateTemp("", "kasher-*.toml")
+	if err != nil {
+		return false, err
+	}
+	path := file.Name()
+	file.Close()
+	defer os.Remove(path)
+
+	body := content
+	var checkErr error
+	for {
+		header := fmt.Sprintf("# Editing %s. Save and close the editor to apply your changes.\n", subject)
+		header += "# Leave the file empty to cancel. Lines starting with '#' are ignored.\n"
+		if checkErr != nil {
+			for _, line := range strings.Split(checkErr.Error(), "\n") {
+				header += "# ERROR: " + line + "\n"
+			}
+		}
+		if err := os.WriteFile(path, []byte(header+body), 0o600); err != nil {
+			return false, err
+		}
+		if err := runEditor(path); err != nil {
+			return false, err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return false, err
+		}
+		body = stripLeadingComments(string(data))
+		if strings.TrimSpace(body) == "" {
+			fmt.Println("Edit cancelled.")
+			return false, nil
+		}
+		if strings.TrimSpace(body) == strings.TrimSpace(content) {
+			fmt.Println("No changes made.")
+			return false, nil
+		}
+		if checkErr = check([]byte(body)); checkErr == nil {
+			return true, nil
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n", checkErr)
+	}
+}
+
+// stripLeadingComments removes the comment lines kasher puts at the top of the file.
+func stripLeadingComments(s string) string {
+	for strings.HasPrefix(s, "#") {
+		_, rest, found := strings.Cut(s, "\n")
+		if !found {
+			return ""
+		}
+		s = rest
+	}
+	return s
+}
+
+// runEditor opens path in $VISUAL or $EDITOR and waits for it to close. The editor
+// setting may include arguments, e.g. "code --wait".
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	shell := exec.Command("sh", "-c", editor+` "$1"`, "kasher", path)
+	shell.Stdin = os.Stdin
+	shell.Stdout = os.Stdout
+	shell.Stderr = os.Stderr
+	if err := shell.Run(); err != nil {
+		return fmt.Errorf("editor %q failed: %w", editor, err)
+	}
+	return nil
+}
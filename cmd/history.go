@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"kasher/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+var historyArgs []string
+var diffArgs []string
+var diffStderr bool
+
+var historyCmd = &cobra.Command{
+	Use:   "history <task>",
+	Short: "List the past outputs kept for a task",
+	Long: `List the past outputs kept for a task, most recent first. Entries are numbered
+from 1, the latest run; pass the numbers to 'kasher diff' to compare two runs.
+
+Kasher only keeps past outputs for tasks with a history setting, or when history is
+set in settings.toml. For tasks that take arguments, pass them with --arg.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cacheKey, err := historyCacheKey(args[0], historyArgs)
+		if err != nil {
+			return err
+		}
+		entries, err := config.ListHistory(cacheKey)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			fmt.Printf("No history for task '%s'. Set its history setting to keep past outputs.\n", args[0])
+			return nil
+		}
+
+		// Read every entry first so each can be compared with the run before it
+		outputs := make([]*config.CacheEntry, len(entries))
+		for i, historyEntry := range entries {
+			if entry, err := config.ReadHistory(cacheKey, historyEntry.Index); err == nil {
+				outputs[i] = &entry
+			}
+		}
+
+		now := time.Now()
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "#\tFETCHED\tAGE\tEXIT\tDURATION\tOUTPUT\tCHANGE")
+		for i, entry := range outputs {
+			if entry == nil {
+				fmt.Fprintf(writer, "%d\t%s\t-\t-\t-\t-\t(unreadable)\n", entries[i].Index, entries[i].Timestamp.Local().Format(time.DateTime))
+				continue
+			}
+			change := "-"
+			if i+1 < len(outputs) && outputs[i+1] != nil {
+				change = "changed"
+				if outputs[i+1].SameOutput(*entry) {
+					change = "same"
+				}
+			}
+			fmt.Fprintf(writer, "%d\t%s\t%s\t%d\t%s\t%s\t%s\n",
+				entries[i].Index,
+				entry.Timestamp.Local().Format(time.DateTime),
+				formatSeconds(now.Sub(entry.Timestamp).Seconds()),
+				entry.ExitCode,
+				entry.Duration.Round(time.Millisecond),
+				formatBytes(int64(len(entry.Stdout))),
+				change,
+			)
+		}
+		return writer.Flush()
+	},
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <task> [a] [b]",
+	Short: "Show what changed in a task's output between two runs",
+	Long: `Show a unified diff of a task's output between two runs kept in its history
+(see 'kasher history'). Runs are numbered from 1, the latest. Without numbers the
+latest run is compared with the one before it; with one number, that run is
+compared with the latest.
+
+Exits with status 1 when the outputs differ, like diff(1).`,
+	Args: cobra.RangeArgs(1, 3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		from, to := 2, 1
+		if len(args) > 1 {
+			var err error
+			if from, err = parseHistoryIndex(args[1]); err != nil {
+				return err
+			}
+		}
+		if len(args) > 2 {
+			var err error
+			if to, err = parseHistoryIndex(args[2]); err != nil {
+				return err
+			}
+		}
+
+		cacheKey, err := historyCacheKey(args[0], diffArgs)
+		if err != nil {
+			return err
+		}
+		entries, err := config.ListHistory(cacheKey)
+		if err != nil {
+			return err
+		}
+		if len(entries) < 2 {
+			return fmt.Errorf("task '%s' has %d runs in its history; at least 2 are needed to diff (set its history setting to keep past outputs)", args[0], len(entries))
+		}
+		fromEntry, err := config.ReadHistory(cacheKey, from)
+		if err != nil {
+			return err
+		}
+		toEntry, err := config.ReadHistory(cacheKey, to)
+		if err != nil {
+			return err
+		}
+
+		fromOutput, toOutput := fromEntry.Stdout, toEntry.Stdout
+		if diffStderr {
+			fromOutput, toOutput = fromEntry.Stderr, toEntry.Stderr
+		}
+		if bytes.Equal(fromOutput, toOutput) {
+			return nil
+		}
+		err = runDiff(
+			fmt.Sprintf("#%d %s", from, fromEntry.Timestamp.Local().Format(time.DateTime)), fromOutput,
+			fmt.Sprintf("#%d %s", to, toEntry.Timestamp.Local().Format(time.DateTime)), toOutput,
+		)
+		var exitErr *exitError
+		if errors.As(err, &exitErr) {
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+		}
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(diffCmd)
+	historyCmd.Flags().StringArrayVarP(&historyArgs, "arg", "a", nil, "Argument of a parameterized task (repeatable)")
+	diffCmd.Flags().StringArrayVarP(&diffArgs, "arg", "a", nil, "Argument of a parameterized task (repeatable)")
+	diffCmd.Flags().BoolVar(&diffStderr, "stderr", false, "Compare stderr instead of stdout")
+}
+
+// historyCacheKey returns the cache key whose history holds the runs of the task
+// with the given arguments.
+func historyCacheKey(taskName string, args []string) (string, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return "", err
+	}
+	task, exists := cfg[taskName]
+	if !exists {
+		return "", fmt.Errorf("task '%s' does not exist", taskName)
+	}
+	command, err := task.RenderCommand(args)
+	if err != nil {
+		return "", fmt.Errorf("task '%s': %w (pass arguments with --arg)", taskName, err)
+	}
+	return task.CacheKeyFor(taskName, command), nil
+}
+
+// parseHistoryIndex parses the number of a run in a task's history.
+func parseHistoryIndex(s string) (int, error) {
+	index, err := strconv.Atoi(s)
+	if err != nil || index < 1 {
+		return 0, fmt.Errorf("invalid run %q: expected a number from 1 (the latest run)", s)
+	}
+	return index, nil
+}
+
+// runDiff prints a unified diff of two outputs with diff(1). It returns an exitError
+// with status 1 when they differ.
+func runDiff(fromLabel string, from []byte, toLabel string, to []byte) error {
+	dir, err := os.MkdirTemp("", "kasher-diff-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	fromPath, toPath := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	if err := os.WriteFile(fromPath, from, 0o600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(toPath, to, 0o600); err != nil {
+		return err
+	}
+	diff := exec.Command("diff", "-u", "-L", fromLabel, "-L", toLabel, fromPath, toPath)
+	diff.Stdout = os.Stdout
+	diff.Stderr = os.Stderr
+	err = diff.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return &exitError{code: 1}
+	}
+	return err
+}
@@ -0,0 +1,384 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"kasher/internal/config"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats of the task list.
+const (
+	listFormatTable = "table"
+	listFormatJSON  = "json"
+	listFormatYAML  = "yaml"
+	listFormatTSV   = "tsv"
+)
+
+// Cache states reported for a task.
+const (
+	statusFresh    = "fresh"
+	statusStale    = "stale"
+	statusUncached = "uncached"
+)
+
+var listFormat string
+var listSort string
+var listFilters []string
+
+// taskStatus is a task's definition together with the state of its cache, as shown
+// by 'kasher task list'. Durations are in seconds so they are easy to process.
+type taskStatus struct {
+	Name             string     `json:"name" yaml:"name"`
+	Command          string     `json:"command" yaml:"command"`
+	Expiration       string     `json:"expiration" yaml:"expiration"`
+	Notes            string     `json:"notes,omitempty" yaml:"notes,omitempty"`
+	Origin           string     `json:"origin,omitempty" yaml:"origin,omitempty"`
+	Status           string     `json:"status" yaml:"status"`
+	LastFetched      *time.Time `json:"lastFetched,omitempty" yaml:"lastFetched,omitempty"`
+	AgeSeconds       *float64   `json:"ageSeconds,omitempty" yaml:"ageSeconds,omitempty"`
+	ExpiresAt        *time.Time `json:"expiresAt,omitempty" yaml:"expiresAt,omitempty"`
+	ExpiresInSeconds *float64   `json:"expiresInSeconds,omitempty" yaml:"expiresInSeconds,omitempty"`
+	CacheFile        string     `json:"cacheFile,omitempty" yaml:"cacheFile,omitempty"`
+	CacheSize        int64      `json:"cacheSize" yaml:"cacheSize"`
+	LastExitCode     *int       `json:"lastExitCode,omitempty" yaml:"lastExitCode,omitempty"`
+	LastDuration     string     `json:"lastDuration,omitempty" yaml:"lastDuration,omitempty"`
+	Hits             int        `json:"hits" yaml:"hits"`
+	Runs             int        `json:"runs" yaml:"runs"`
+}
+
+// inspectTask gathers the cache state of a run of the task with the given arguments.
+// Tasks missing arguments they need, or whose cache can't be read, are reported as uncached.
+func inspectTask(name string, task config.TaskConfig, args []string, state config.TaskState, now time.Time) taskStatus {
+	status := taskStatus{
+		Name:         name,
+		Command:      task.Command,
+		Expiration:   task.Expiration,
+		Notes:        task.Notes,
+		Origin:       task.Origin,
+		Status:       statusUncached,
+		LastDuration: state.LastDuration,
+		Hits:         state.Hits,
+		Runs:         state.Runs,
+	}
+	if state.Runs > 0 {
+		exitCode := state.LastExitCode
+		status.LastExitCode = &exitCode
+	}
+	command, err := task.RenderCommand(args)
+	if err != nil {
+		return status
+	}
+	cacheKey := task.CacheKeyFor(name, command)
+	if path, err := config.GetCacheFilePath(cacheKey); err == nil {
+		if info, err := os.Stat(path); err == nil {
+			status.CacheFile = path
+			status.CacheSize = info.Size()
+		}
+	}
+	cached, err := config.ReadCache(cacheKey)
+	if err != nil {
+		return status
+	}
+	fetched := cached.Timestamp
+	age := now.Sub(fetched).Seconds()
+	status.LastFetched = &fetched
+	status.AgeSeconds = &age
+
+	status.Status = statusStale
+	expiresAt, ok := task.ExpiresAt(fetched)
+	if !ok {
+		return status
+	}
+	expiresIn := expiresAt.Sub(now).Seconds()
+	status.ExpiresAt = &expiresAt
+	status.ExpiresInSeconds = &expiresIn
+	watchDigest, err := task.WatchDigest()
+	if now.Before(expiresAt) && !state.LastFetched.IsZero() && err == nil && watchDigest == cached.WatchDigest {
+		status.Status = statusFresh
+	}
+	return status
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all tasks",
+	Long: `List all tasks with the state of their cache.
+
+Filters take the form key=value and can be repeated; a task must match all of them.
+Keys are name (a glob such as 'k8s-*'), status (fresh, stale or uncached),
+origin (global or project) and exit (the last exit code).`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if verbose && listFormat == listFormatTable {
+			printVerboseInfo()
+		}
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return err
+		}
+		state, err := config.LoadState()
+		if err != nil {
+			return fmt.Errorf("failed to load state: %w", err)
+		}
+
+		now := time.Now()
+		var tasks []taskStatus
+		for name, task := range cfg {
+			status := inspectTask(name, task, nil, state[task.StateKey(name)], now)
+			matched, err := matchesFilters(status, listFilters)
+			if err != nil {
+				return err
+			}
+			if matched {
+				tasks = append(tasks, status)
+			}
+		}
+		if err := sortTaskStatuses(tasks, listSort); err != nil {
+			return err
+		}
+
+		switch listFormat {
+		case listFormatTable:
+			printTaskTable(tasks, len(cfg))
+			return nil
+		case listFormatTSV:
+			printTaskTSV(tasks)
+			return nil
+		case listFormatJSON:
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetEscapeHTML(false)
+			encoder.SetIndent("", "  ")
+			if tasks == nil {
+				tasks = []taskStatus{}
+			}
+			return encoder.Encode(tasks)
+		case listFormatYAML:
+			data, err := yaml.Marshal(tasks)
+			if err != nil {
+				return err
+			}
+			_, err = os.Stdout.Write(data)
+			return err
+		}
+		return fmt.Errorf("unsupported format %q (expected %s, %s, %s or %s)", listFormat, listFormatTable, listFormatJSON, listFormatYAML, listFormatTSV)
+	},
+}
+
+func init() {
+	listCmd.Flags().StringVar(&listFormat, "format", listFormatTable, "Output format: table, json, yaml or tsv")
+	listCmd.Flags().StringVar(&listSort, "sort", "name", "Sort by name, status, age, expires, size or duration; prefix with - to reverse")
+	listCmd.Flags().StringArrayVar(&listFilters, "filter", nil, "Only list tasks matching key=value (repeatable)")
+}
+
+// matchesFilters reports whether the task matches every key=value filter.
+func matchesFilters(task taskStatus, filters []string) (bool, error) {
+	for _, filter := range filters {
+		key, value, ok := strings.Cut(filter, "=")
+		if !ok {
+			return false, fmt.Errorf("invalid filter %q: expected key=value", filter)
+		}
+		switch key {
+		case "name":
+			matched, err := path.Match(value, task.Name)
+			if err != nil {
+				return false, fmt.Errorf("invalid filter %q: %w", filter, err)
+			}
+			if !matched {
+				return false, nil
+			}
+		case "status":
+			if task.Status != value {
+				return false, nil
+			}
+		case "origin":
+			origin := "global"
+			if task.Origin != "" {
+				origin = "project"
+			}
+			if origin != value {
+				return false, nil
+			}
+		case "exit":
+			code, err := strconv.Atoi(value)
+			if err != nil {
+				return false, fmt.Errorf("invalid filter %q: exit code must be a number", filter)
+			}
+			if task.LastExitCode == nil || *task.LastExitCode != code {
+				return false, nil
+			}
+		default:
+			return false, fmt.Errorf("invalid filter %q: unknown key %q (expected name, status, origin or exit)", filter, key)
+		}
+	}
+	return true, nil
+}
+
+// sortTaskStatuses orders tasks by the given key, falling back to their names.
+// Tasks without a value for the key come last.
+func sortTaskStatuses(tasks []taskStatus, key string) error {
+	reverse := strings.HasPrefix(key, "-")
+	key = strings.TrimPrefix(key, "-")
+	var value func(task taskStatus) (float64, bool)
+	switch key {
+	case "name":
+	case "status":
+		rank := map[string]float64{statusFresh: 0, statusStale: 1, statusUncached: 2}
+		value = func(task taskStatus) (float64, bool) { return rank[task.Status], true }
+	case "age":
+		value = func(task taskStatus) (float64, bool) { return optionalValue(task.AgeSeconds) }
+	case "expires":
+		value = func(task taskStatus) (float64, bool) { return optionalValue(task.ExpiresInSeconds) }
+	case "size":
+		value = func(task taskStatus) (float64, bool) { return float64(task.CacheSize), true }
+	case "duration":
+		value = func(task taskStatus) (float64, bool) {
+			d, err := time.ParseDuration(task.LastDuration)
+			return d.Seconds(), err == nil
+		}
+	default:
+		return fmt.Errorf("invalid sort key %q (expected name, status, age, expires, size or duration)", key)
+	}
+	sort.SliceStable(tasks, func(i, j int) bool {
+		a, b := tasks[i], tasks[j]
+		if value != nil {
+			av, aok := value(a)
+			bv, bok := value(b)
+			if aok != bok {
+				return aok
+			}
+			if av != bv {
+				return (av < bv) != reverse
+			}
+		}
+		if value == nil && reverse {
+			return a.Name > b.Name
+		}
+		return a.Name < b.Name
+	})
+	return nil
+}
+
+// optionalValue dereferences an optional number, reporting whether it was set.
+func optionalValue(v *float64) (float64, bool) {
+	if v == nil {
+		return 0, false
+	}
+	return *v, true
+}
+
+// printTaskTable prints the tasks as an aligned table for people to read.
+func printTaskTable(tasks []taskStatus, total int) {
+	if total == 0 {
+		fmt.Println("No tasks found.")
+		return
+	}
+	if len(tasks) == 0 {
+		fmt.Println("No tasks match the filters.")
+		return
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "NAME\tSTATUS\tFETCHED\tAGE\tEXPIRES\tSIZE\tEXIT\tDURATION\tEXPIRATION\tCOMMAND")
+	projectFile := ""
+	for _, task := range tasks {
+		name := task.Name
+		if task.Origin != "" {
+			name += " [project]"
+			projectFile = task.Origin
+		}
+		fetched, age, expires := "-", "-", "-"
+		if task.LastFetched != nil {
+			fetched = task.LastFetched.Local().Format(time.DateTime)
+			age = formatSeconds(*task.AgeSeconds)
+		}
+		if task.ExpiresInSeconds != nil {
+			if *task.ExpiresInSeconds >= 0 {
+				expires = "in " + formatSeconds(*task.ExpiresInSeconds)
+			} else {
+				expires = formatSeconds(-*task.ExpiresInSeconds) + " ago"
+			}
+		}
+		size := "-"
+		if task.CacheFile != "" {
+			size = formatBytes(task.CacheSize)
+		}
+		exitCode := "-"
+		if task.LastExitCode != nil {
+			exitCode = strconv.Itoa(*task.LastExitCode)
+		}
+		duration := task.LastDuration
+		if duration == "" {
+			duration = "-"
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", name, task.Status, fetched, age, expires,
+			size, exitCode, duration, task.Expiration, firstLine(task.Command))
+	}
+	writer.Flush()
+	if projectFile != "" {
+		fmt.Printf("\n[project] tasks come from %s and take precedence over global tasks with the same name.\n", projectFile)
+	}
+}
+
+// printTaskTSV prints the tasks as tab-separated values with a header row. Times are
+// RFC 3339, durations are in seconds and sizes in bytes; missing values are empty.
+func printTaskTSV(tasks []taskStatus) {
+	fmt.Println(strings.Join([]string{"name", "status", "lastFetched", "ageSeconds", "expiresAt", "expiresInSeconds",
+		"cacheSize", "lastExitCode", "lastDuration", "expiration", "origin", "command"}, "\t"))
+	for _, task := range tasks {
+		fields := []string{task.Name, task.Status, "", "", "", "", strconv.FormatInt(task.CacheSize, 10), "",
+			task.LastDuration, task.Expiration, task.Origin, task.Command}
+		if task.LastFetched != nil {
+			fields[2] = task.LastFetched.Format(time.RFC3339)
+			fields[3] = strconv.FormatFloat(*task.AgeSeconds, 'f', 0, 64)
+		}
+		if task.ExpiresAt != nil {
+			fields[4] = task.ExpiresAt.Format(time.RFC3339)
+			fields[5] = strconv.FormatFloat(*task.ExpiresInSeconds, 'f', 0, 64)
+		}
+		if task.LastExitCode != nil {
+			fields[7] = strconv.Itoa(*task.LastExitCode)
+		}
+		for i, field := range fields {
+			fields[i] = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(field)
+		}
+		fmt.Println(strings.Join(fields, "\t"))
+	}
+}
+
+// formatSeconds renders a number of seconds as a duration rounded to the second.
+func formatSeconds(seconds float64) string {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Second).String()
+}
+
+// formatBytes renders a size in bytes with a binary unit, e.g. 1.5 KiB.
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// firstLine returns the first line of a multi-line command, marking that it goes on.
+func firstLine(s string) string {
+	line, rest, found := strings.Cut(strings.TrimSpace(s), "\n")
+	if found && rest != "" {
+		return line + " ..."
+	}
+	return line
+}
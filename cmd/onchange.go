@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"kasher/internal/config"
+)
+
+// runOnChangeHook runs the task's onChange command after a refresh cached output that
+// differs from the previous entry, which is nil on the first fetch. The old and new
+// output are written to temporary files whose paths are passed in KASHER_OLD_CACHE and
+// KASHER_NEW_CACHE. The hook's output goes to stderr so it never mixes with the task's.
+func runOnChangeHook(taskName string, task config.TaskConfig, previous *config.CacheEntry, entry config.CacheEntry) error {
+	dir, err := os.MkdirTemp("", "kasher-onchange-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	oldPath := ""
+	if previous != nil {
+		oldPath = filepath.Join(dir, "old")
+		if err := os.WriteFile(oldPath, previous.Stdout, 0o600); err != nil {
+			return err
+		}
+	}
+	newPath := filepath.Join(dir, "new")
+	if err := os.WriteFile(newPath, entry.Stdout, 0o600); err != nil {
+		return err
+	}
+
+	hook := exec.Command("sh", "-c", task.OnChange)
+	hook.Dir = task.WorkDir()
+	hook.Env = append(os.Environ(),
+		"KASHER_TASK="+taskName,
+		"KASHER_OLD_CACHE="+oldPath,
+		"KASHER_NEW_CACHE="+newPath,
+		"KASHER_EXIT_CODE="+strconv.Itoa(entry.ExitCode),
+	)
+	hook.Stdout = os.Stderr
+	hook.Stderr = os.Stderr
+	if err := hook.Run(); err != nil {
+		return fmt.Errorf("onChange hook: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// detachedProcAttr starts a process in its own session so it outlives the
+// terminal and the kasher invocation that launched it.
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
+
+// setProcessGroup runs the command in its own process group so that cancelling it
+// kills the shell together with everything it started. When stdin is a terminal the
+// group becomes the terminal's foreground group, so the command can still prompt for
+// input and receives Ctrl-C itself. The returned function hands the terminal back to
+// kasher and must be called once the command has exited.
+func setProcessGroup(c *exec.Cmd) (restore func()) {
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	c.Cancel = func() error {
+		return syscall.Kill(-c.Process.Pid, syscall.SIGKILL)
+	}
+	tty, ok := c.Stdin.(*os.File)
+	if !ok || !term.IsTerminal(int(tty.Fd())) {
+		return func() {}
+	}
+	c.SysProcAttr.Foreground = true
+	c.SysProcAttr.Ctty = int(tty.Fd())
+	pgrp := syscall.Getpgrp()
+	return func() {
+		// kasher is a background process until it takes the terminal back, which
+		// would stop it with SIGTTOU unless the signal is ignored
+		signal.Ignore(syscall.SIGTTOU)
+		defer signal.Reset(syscall.SIGTTOU)
+		_ = unix.IoctlSetPointerInt(int(tty.Fd()), unix.TIOCSPGRP, pgrp)
+	}
+}
@@ -0,0 +1,25 @@
+//go:build windows
+
+package cmd
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachedProcess is the DETACHED_PROCESS process creation flag.
+const detachedProcess = 0x00000008
+
+// detachedProcAttr starts a process without a console in a new process group so it
+// outlives the kasher invocation that launched it.
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: detachedProcess | syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// setProcessGroup runs the command in a new process group. Cancelling it kills the
+// shell; processes it started are not tracked on Windows. The returned function
+// does nothing; it exists for parity with other platforms.
+func setProcessGroup(c *exec.Cmd) (restore func()) {
+	c.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+	return func() {}
+}
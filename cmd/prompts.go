@@ -12,8 +12,9 @@ import (
 )
 
 // PromptTaskDetails interactively asks the user for task details.
+// Settings that are not prompted for are carried over from existing.
 func PromptTaskDetails(existing *config.TaskConfig, skipCommandPrompt bool) (config.TaskConfig, error) {
-	var task config.TaskConfig
+	task := *existing
 	if skipCommandPrompt && existing.Command != "" {
 		task.Command = existing.Command
 	} else {
@@ -37,7 +38,7 @@ func PromptTaskDetails(existing *config.TaskConfig, skipCommandPrompt bool) (con
 			defaultExpiration = "24h"
 		}
 		prompt := &survey.Input{
-			Message: "Cache expiration (e.g. 10m, 1h, 2h30m, 45s, 1.5h, 500ms):",
+			Message: "Cache expiration (e.g. 10m, 1h, 2h30m, @hourly, at 09:00, 0 9 * * 1-5):",
 			Default: defaultExpiration,
 		}
 		survey.AskOne(prompt, &expiration)
@@ -51,6 +52,11 @@ func PromptTaskDetails(existing *config.TaskConfig, skipCommandPrompt bool) (con
 				fmt.Println("  1.5h     (1.5 hours)")
 				fmt.Println("  500ms    (500 milliseconds)")
 				fmt.Println("See https://pkg.go.dev/time#ParseDuration for all valid formats.")
+				fmt.Println("Or expire the cache on a schedule:")
+				fmt.Println("  @hourly      (at the top of every hour)")
+				fmt.Println("  @daily       (at midnight)")
+				fmt.Println("  at 09:00     (every day at 09:00 local time)")
+				fmt.Println("  0 9 * * 1-5  (cron expression: weekdays at 09:00)")
 				continue
 			}
 			return task, fmt.Errorf("user exited prompt")
@@ -59,8 +65,8 @@ func PromptTaskDetails(existing *config.TaskConfig, skipCommandPrompt bool) (con
 			fmt.Println("Expiration is required.")
 			continue
 		}
-		if _, err := time.ParseDuration(expiration); err != nil {
-			fmt.Printf("Invalid duration: %v\n", err)
+		if _, err := config.ParseExpiration(expiration); err != nil {
+			fmt.Printf("Invalid expiration: %v\n", err)
 			continue
 		}
 		task.Expiration = expiration
@@ -102,14 +108,39 @@ func PromptTaskName(cfg config.KasherConfig, message string) (string, error) {
 	return selected, nil
 }
 
+// PromptConfigBackup prompts the user to select one of the config backups and
+// returns its index.
+func PromptConfigBackup(backups []config.ConfigBackup) (int, error) {
+	var options []string
+	for _, backup := range backups {
+		description := "unreadable"
+		if cfg, err := config.LoadConfigBackup(backup.Index); err == nil {
+			description = fmt.Sprintf("%d tasks", len(cfg))
+		}
+		options = append(options, fmt.Sprintf("%d: saved %s (%s)", backup.Index, backup.ModTime.Format(time.DateTime), description))
+	}
+	var selected int
+	prompt := &survey.Select{
+		Message: "Select a backup to restore:",
+		Options: options,
+	}
+	if err := survey.AskOne(prompt, &selected); err != nil {
+		return 0, err
+	}
+	return backups[selected].Index, nil
+}
+
 // reservedTaskNames contains task names that are reserved and cannot be used by the user.
 var reservedTaskNames = map[string]struct{}{
-	"task": {},
-	"quit": {},
-	"q":    {},
-	"exit": {},
-	"?":    {},
-	"help": {},
+	"task":    {},
+	"cache":   {},
+	"history": {},
+	"diff":    {},
+	"quit":    {},
+	"q":       {},
+	"exit":    {},
+	"?":       {},
+	"help":    {},
 }
 
 // isReservedTaskName checks if a given name is reserved.
@@ -155,6 +186,25 @@ func PromptForTaskName(cfg config.KasherConfig, message string) (string, error)
 	}
 }
 
+// normalizeTaskName checks a new task name given on the command line against the same
+// rules PromptForTaskName applies, returning an error instead of asking again.
+func normalizeTaskName(cfg config.KasherConfig, name string) (string, error) {
+	if strings.TrimSpace(name) == "" {
+		return "", fmt.Errorf("task name cannot be empty")
+	}
+	if isReservedTaskName(name) {
+		return "", fmt.Errorf("the name '%s' is reserved and cannot be used. Please choose another name", name)
+	}
+	if strings.Contains(name, " ") {
+		name = replaceSpacesWithDashes(name)
+		fmt.Printf("Note: Spaces in task name will be replaced with dashes: '%s'\n", name)
+	}
+	if _, exists := cfg[name]; exists {
+		return "", fmt.Errorf("task '%s' already exists", name)
+	}
+	return name, nil
+}
+
 // replaceSpacesWithDashes replaces all spaces in a string with dashes
 func replaceSpacesWithDashes(s string) string {
 	result := ""
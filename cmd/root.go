@@ -1,14 +1,10 @@
 package cmd
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
-	"io"
 	"os"
-	"os/exec"
-	"path/filepath"
 	"sort"
-	"time"
 
 	"kasher/internal/config"
 
@@ -19,9 +15,13 @@ import (
 var forceRefresh bool
 var verbose bool
 var clearTimestamp bool
+var backgroundRefresh bool
+var offline bool
+var commandTimeout string
+var changedOnly bool
 
 var rootCmd = &cobra.Command{
-	Use:   "kasher [taskName]",
+	Use:   "kasher [taskName] [args...]",
 	Short: "kasher - shell task runner with caching",
 	Long:  "kasher lets you define, run, and cache named shell tasks.",
 	Args:  cobra.ArbitraryArgs, // Accept any arguments (task names)
@@ -62,93 +62,35 @@ var rootCmd = &cobra.Command{
 			if err != nil {
 				return fmt.Errorf("failed to load config: %w", err)
 			}
-			taskName := args[0]
-			task, exists := cfg[taskName]
-			if !exists {
-				fmt.Fprintf(os.Stderr, "Task '%s' not found.\n", taskName)
-				fmt.Fprintln(os.Stderr, "Run 'kasher task list' to see available tasks.")
-				return nil
-			}
-
-			if verbose {
-				configPath, err := config.GetConfigPath()
-				if err == nil {
-					fmt.Println("Kasher config file location:")
-					fmt.Println(configPath)
-				}
-				dir, err := os.UserCacheDir()
-				if err == nil {
-					fmt.Println("Kasher cache directory:")
-					fmt.Println(filepath.Join(dir, "kasher"))
-				}
-			}
-
-			// Clear timestamp if requested (forces refresh on next execution)
-			if clearTimestamp {
-				task.LastFetched = ""
-				cfg[taskName] = task
-				if err := config.SaveConfig(cfg); err != nil {
-					fmt.Fprintf(os.Stderr, "Warning: Failed to save cleared timestamp: %v\n", err)
-				}
-				if verbose {
-					fmt.Printf("Cleared last fetch timestamp for task '%s'. Next execution will refresh cache.\n", taskName)
-				}
-				return nil
+			// Failures past this point are the task's, not a misuse of kasher
+			cmd.SilenceUsage = true
+			err = runTask(cfg, args[0], args[1:])
+			var exitErr *exitError
+			if errors.As(err, &exitErr) {
+				// The task's own output already explains the failure
+				cmd.SilenceErrors = true
 			}
-
-			// Check cache validity, skip if forceRefresh is set
-			cacheValid := false
-			if !forceRefresh && task.LastFetched != "" && task.Expiration != "" {
-				lastFetched, err := time.Parse(time.RFC3339, task.LastFetched)
-				if err == nil {
-					expDur, err := time.ParseDuration(task.Expiration)
-					if err == nil && time.Since(lastFetched) < expDur {
-						cacheValid = true
-					}
-				}
-			}
-
-			if cacheValid {
-				cached, err := config.ReadCache(taskName)
-				if err == nil {
-					fmt.Print(cached)
-					return nil
-				}
-				// If cache read fails, fall through to re-run the command
-			}
-
-			// Prepare to capture and stream output
-			var outBuf, errBuf bytes.Buffer
-			command := exec.Command("sh", "-c", task.Command)
-			command.Stdout = io.MultiWriter(os.Stdout, &outBuf)
-			command.Stderr = io.MultiWriter(os.Stderr, &errBuf)
-			command.Stdin = os.Stdin
-
-			fmt.Printf("Running: %s\n", task.Command)
-			err = command.Run()
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error running command: %v\n", err)
-			}
-
-			// Combine output for caching
-			output := outBuf.String() + errBuf.String()
-
-			// Save output to cache file
-			_ = config.WriteCache(taskName, output)
-
-			// Update LastFetched and save config
-			task.LastFetched = time.Now().Format(time.RFC3339)
-			cfg[taskName] = task
-			_ = config.SaveConfig(cfg) // handle error as needed
-
 			return err
 		}
 		return cmd.Help()
 	},
 }
 
+// exitError reports the non-zero exit status of a task so kasher can exit with it.
+type exitError struct {
+	code int
+}
+
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
+		var exitErr *exitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
@@ -156,8 +98,15 @@ func Execute() {
 
 func init() {
 	rootCmd.AddCommand(taskCmd)
+	rootCmd.AddCommand(cacheCmd)
 	rootCmd.SuggestionsMinimumDistance = 2
 	rootCmd.PersistentFlags().BoolVarP(&forceRefresh, "force", "f", false, "Force refresh of cached task output")
 	rootCmd.PersistentFlags().BoolVarP(&clearTimestamp, "clear-timestamp", "c", false, "Clear last fetch timestamp to force refresh on next execution")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Show extra information")
+	rootCmd.Flags().BoolVar(&offline, "offline", false, "Serve cached output regardless of age without running the command")
+	rootCmd.Flags().StringVar(&commandTimeout, "timeout", "", "Kill the command if it runs longer than this duration (overrides the task's timeout)")
+	rootCmd.Flags().BoolVar(&changedOnly, "changed-only", false, fmt.Sprintf("Print nothing and exit with status %d unless a refresh produced new output", exitCodeUnchanged))
+	// Used internally to refresh stale-while-revalidate caches from a detached process
+	rootCmd.Flags().BoolVar(&backgroundRefresh, "background-refresh", false, "Refresh the task cache without printing output")
+	rootCmd.Flags().MarkHidden("background-refresh")
 }
@@ -0,0 +1,514 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"kasher/internal/config"
+)
+
+// Exit codes kasher uses when a command does not finish on its own.
+const (
+	exitCodeTimeout     = 124 // same as timeout(1)
+	exitCodeInterrupted = 130
+	// exitCodeUnchanged is returned with --changed-only when there is no new output.
+	exitCodeUnchanged = 100
+)
+
+// errInterrupted is returned when a command with a timeout is stopped by Ctrl-C.
+var errInterrupted = errors.New("interrupted")
+
+// timeoutError reports that a command was killed for running longer than its timeout.
+type timeoutError struct {
+	timeout time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("command timed out after %s", e.timeout)
+}
+
+// runTask runs the named task with the given arguments, serving the cached
+// result instead while it is still fresh.
+func runTask(cfg config.KasherConfig, taskName string, args []string) error {
+	task, exists := cfg[taskName]
+	if !exists {
+		fmt.Fprintf(os.Stderr, "Task '%s' not found.\n", taskName)
+		fmt.Fprintln(os.Stderr, "Run 'kasher task list' to see available tasks.")
+		return nil
+	}
+
+	if err := task.Validate(); err != nil {
+		return fmt.Errorf("task '%s': %w", taskName, err)
+	}
+	if commandTimeout != "" {
+		if _, err := time.ParseDuration(commandTimeout); err != nil {
+			return fmt.Errorf("invalid --timeout %q: %w", commandTimeout, err)
+		}
+		task.Timeout = commandTimeout
+	}
+
+	// Fill any placeholders in the command from the remaining arguments.
+	// Parameterized tasks cache each rendered command separately.
+	command, err := task.RenderCommand(args)
+	if err != nil {
+		return fmt.Errorf("task '%s': %w", taskName, err)
+	}
+	cacheKey := task.CacheKeyFor(taskName, command)
+	stateKey := task.StateKey(taskName)
+
+	if verbose {
+		configPath, err := config.GetConfigPath()
+		if err == nil {
+			fmt.Println("Kasher config file location:")
+			fmt.Println(configPath)
+		}
+		settingsPath, err := config.GetSettingsPath()
+		if err == nil {
+			fmt.Println("Kasher settings file location:")
+			fmt.Println(settingsPath)
+		}
+		dir, err := os.UserCacheDir()
+		if err == nil {
+			fmt.Println("Kasher cache directory:")
+			fmt.Println(filepath.Join(dir, "kasher"))
+		}
+		if task.IsProjectTask() {
+			fmt.Println("Task defined in project file:")
+			fmt.Println(task.Origin)
+		}
+	}
+
+	// Clear timestamp if requested (forces refresh on next execution)
+	if clearTimestamp {
+		err := config.UpdateTaskState(stateKey, func(state *config.TaskState) {
+			state.LastFetched = time.Time{}
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to save cleared timestamp: %v\n", err)
+		}
+		if verbose {
+			fmt.Printf("Cleared last fetch timestamp for task '%s'. Next execution will refresh cache.\n", taskName)
+		}
+		return nil
+	}
+
+	state, err := config.LoadState()
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+	lastFetched := state[stateKey].LastFetched
+	cached, cacheErr := config.ReadCache(cacheKey)
+	watchDigest, err := task.WatchDigest()
+	if err != nil {
+		return fmt.Errorf("task '%s': %w", taskName, err)
+	}
+	// A change to any watched file makes the cache stale regardless of its age
+	watchedChanged := cacheErr == nil && cached.WatchDigest != watchDigest
+	if watchedChanged && verbose {
+		fmt.Fprintln(os.Stderr, "Watched files changed since the last fetch, refreshing")
+	}
+
+	// In offline mode never run the command; serve whatever is cached, however old
+	if offline {
+		if cacheErr != nil {
+			return fmt.Errorf("offline: no cached output for task '%s'", taskName)
+		}
+		printStaleNotice("offline", cached)
+		return serveCached(stateKey, cacheKey, cached)
+	}
+
+	// Check cache validity, skip if forceRefresh is set
+	if !forceRefresh && !backgroundRefresh && !lastFetched.IsZero() && cacheErr == nil && !watchedChanged {
+		expiresAt, ok := task.ExpiresAt(cached.Timestamp)
+		if ok {
+			now := time.Now()
+			if now.Before(expiresAt) {
+				return serveCached(stateKey, cacheKey, cached)
+			}
+			// Within the stale-while-revalidate window, answer from cache right away
+			// and let a detached kasher process refresh it.
+			if now.Before(expiresAt.Add(task.StaleWhileRevalidateWindow())) {
+				err := startBackgroundRefresh(taskName, args)
+				if err == nil {
+					if verbose {
+						fmt.Fprintf(os.Stderr, "Cache expired %s ago, refreshing in the background\n", now.Sub(expiresAt).Round(time.Second))
+					}
+					return serveCached(stateKey, cacheKey, cached)
+				}
+				fmt.Fprintf(os.Stderr, "Warning: Failed to start background refresh: %v\n", err)
+			}
+		}
+	}
+	// If the cache is missing or stale, fall through to re-run the command
+
+	// Only one kasher process refreshes a cache entry at a time. Others wait for it to
+	// finish and then use its result rather than running the command again.
+	if backgroundRefresh {
+		lock, err := config.TryLockTask(cacheKey)
+		if err != nil || lock == nil {
+			return err // nil lock: another process is already refreshing
+		}
+		defer lock.Unlock()
+		_, _, err = refreshTask(taskName, task, command, cacheKey, false)
+		return err
+	}
+	lock, err := config.LockTask(cacheKey)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if !forceRefresh {
+		latest, err := config.ReadCache(cacheKey)
+		if err == nil && latest.Timestamp.After(cached.Timestamp) && latest.WatchDigest == watchDigest {
+			return serveCached(stateKey, cacheKey, latest)
+		}
+	}
+
+	if !changedOnly || verbose {
+		fmt.Fprintf(os.Stderr, "Running: %s\n", command)
+	}
+	// Output is held back while a retry or a cached entry might be shown in its place,
+	// or until it is known to differ from the cached output
+	stream := !task.KeepLastGood && task.StaleIfErrorWindow() == 0 && task.Retries == 0 && !changedOnly
+	entry, changed, err := refreshTask(taskName, task, command, cacheKey, stream)
+	if err != nil {
+		if errors.Is(err, errInterrupted) {
+			return exitStatus(exitCodeInterrupted)
+		}
+		if previous, ok := fallbackEntry(task, cacheKey); ok {
+			printStaleNotice(err.Error(), previous)
+			return serveCached(stateKey, cacheKey, previous)
+		}
+		var timeoutErr *timeoutError
+		if errors.As(err, &timeoutErr) {
+			if !stream {
+				os.Stdout.Write(entry.Stdout)
+				os.Stderr.Write(entry.Stderr)
+			}
+			fmt.Fprintf(os.Stderr, "kasher: %v\n", err)
+			return exitStatus(exitCodeTimeout)
+		}
+		return err
+	}
+
+	if !task.ShouldCache(entry.ExitCode) {
+		if previous, ok := fallbackEntry(task, cacheKey); ok {
+			printStaleNotice(fmt.Sprintf("command failed with exit status %d", entry.ExitCode), previous)
+			return serveCached(stateKey, cacheKey, previous)
+		}
+	}
+	if changedOnly && !changed {
+		return exitStatus(exitCodeUnchanged)
+	}
+	if !stream {
+		return replayEntry(entry)
+	}
+	return exitStatus(entry.ExitCode)
+}
+
+// fallbackEntry returns the cached entry to show in place of a failed refresh.
+// keepLastGood allows any cached entry; staleIfError only allows entries that
+// expired less than that long ago.
+func fallbackEntry(task config.TaskConfig, cacheKey string) (config.CacheEntry, bool) {
+	if !task.KeepLastGood && task.StaleIfErrorWindow() == 0 {
+		return config.CacheEntry{}, false
+	}
+	previous, err := config.ReadCache(cacheKey)
+	if err != nil {
+		return config.CacheEntry{}, false
+	}
+	if task.KeepLastGood {
+		return previous, true
+	}
+	expiresAt, ok := task.ExpiresAt(previous.Timestamp)
+	if !ok {
+		expiresAt = previous.Timestamp
+	}
+	return previous, time.Now().Before(expiresAt.Add(task.StaleIfErrorWindow()))
+}
+
+// printStaleNotice tells the user on stderr that cached output is being shown and how old it is.
+// With --changed-only nothing is shown, so neither is the notice.
+func printStaleNotice(reason string, entry config.CacheEntry) {
+	if changedOnly {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "kasher: %s, showing cached result from %s ago (%s)\n",
+		reason, time.Since(entry.Timestamp).Round(time.Second), entry.Timestamp.Local().Format(time.RFC1123))
+}
+
+// refreshTask runs the task's command, retrying failed attempts as configured, and if
+// the task's cache policy allows it stores the final result and records the fetch time.
+// Results that may not be cached leave the previous entry and LastFetched untouched,
+// so the next run tries again. It reports whether the result differs from the previously
+// cached output, running the task's onChange hook when a cached result does.
+func refreshTask(taskName string, task config.TaskConfig, command, cacheKey string, stream bool) (config.CacheEntry, bool, error) {
+	// Fingerprint the watched files before running, so changes made while the
+	// command runs still invalidate the entry
+	watchDigest, err := task.WatchDigest()
+	if err != nil {
+		return config.CacheEntry{}, true, err
+	}
+	entry, err := executeWithRetries(task, command, stream)
+	if err != nil {
+		return entry, true, err
+	}
+	entry.WatchDigest = watchDigest
+	entry.Origin = task.Origin
+
+	changed := true
+	cacheable := task.ShouldCache(entry.ExitCode)
+	if cacheable {
+		settings, err := config.LoadSettings()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		cacheable = fitsCacheLimits(task, settings, entry)
+		if cacheable {
+			var previous *config.CacheEntry
+			if cached, err := config.ReadCache(cacheKey); err == nil {
+				previous = &cached
+				changed = !cached.SameOutput(entry)
+			}
+			// Save output to cache file
+			entry.Compression = task.CacheCompression(settings)
+			_ = config.WriteCache(cacheKey, entry)
+			if keep := task.HistoryLength(settings); keep > 0 {
+				if err := config.AppendHistory(cacheKey, entry, keep); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: Failed to record history: %v\n", err)
+				}
+			}
+			enforceCacheBudget(settings, cacheKey)
+			if changed && task.OnChange != "" {
+				if err := runOnChangeHook(taskName, task, previous, entry); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+				}
+			}
+		}
+	} else if verbose {
+		fmt.Fprintf(os.Stderr, "Not caching result: exit status %d is excluded by the task's cache policy\n", entry.ExitCode)
+	}
+
+	_ = config.UpdateTaskState(task.StateKey(taskName), func(state *config.TaskState) {
+		if cacheable {
+			state.LastFetched = entry.Timestamp
+		}
+		state.LastDuration = entry.Duration.Round(time.Millisecond).String()
+		state.LastExitCode = entry.ExitCode
+		state.Runs++
+	}) // handle error as needed
+
+	return entry, changed, nil
+}
+
+// fitsCacheLimits reports whether the entry is small enough to cache under the task's
+// maxCacheSize and the global cache budget, warning on stderr when it is not.
+func fitsCacheLimits(task config.TaskConfig, settings config.Settings, entry config.CacheEntry) bool {
+	size := int64(len(entry.Stdout) + len(entry.Stderr))
+	if limit := task.MaxCacheSizeBytes(); limit > 0 && size > limit {
+		fmt.Fprintf(os.Stderr, "kasher: output is %s, over the task's maxCacheSize of %s; not cached\n", formatBytes(size), formatBytes(limit))
+		return false
+	}
+	if budget, _ := settings.CacheBudgetBytes(); budget > 0 && size > budget {
+		fmt.Fprintf(os.Stderr, "kasher: output is %s, over the cache budget of %s; not cached\n", formatBytes(size), formatBytes(budget))
+		return false
+	}
+	return true
+}
+
+// enforceCacheBudget evicts the least recently used cache entries, other than the
+// one just written, while the cache is over the global budget.
+func enforceCacheBudget(settings config.Settings, cacheKey string) {
+	budget, _ := settings.CacheBudgetBytes()
+	if budget == 0 {
+		return
+	}
+	evicted, err := config.EvictCache(budget, cacheKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to evict cache entries: %v\n", err)
+		return
+	}
+	if verbose {
+		for _, file := range evicted {
+			fmt.Fprintf(os.Stderr, "Evicted cache entry %s (%s, last used %s) to stay within the cache budget\n",
+				file.Key, formatBytes(file.Size+file.HistorySize), file.LastUsed.Local().Format(time.DateTime))
+		}
+	}
+}
+
+// executeWithRetries runs the command up to 1+task.Retries times, waiting
+// task.RetryBackoff before the first retry and doubling the wait after each attempt.
+func executeWithRetries(task config.TaskConfig, command string, stream bool) (config.CacheEntry, error) {
+	backoff := task.RetryBackoffDuration()
+	attempts := task.Retries + 1
+	for attempt := 1; ; attempt++ {
+		entry, err := executeCommand(task, command, stream)
+		if errors.Is(err, errInterrupted) {
+			return entry, err
+		}
+
+		exitCode := entry.ExitCode
+		var timeoutErr *timeoutError
+		if errors.As(err, &timeoutErr) {
+			exitCode = exitCodeTimeout
+		} else if err != nil {
+			// The command could not be started, so trying again won't help
+			return entry, err
+		}
+		if attempt == attempts || !task.ShouldRetry(exitCode) {
+			return entry, err
+		}
+
+		if verbose {
+			reason := fmt.Sprintf("exit status %d", exitCode)
+			if err != nil {
+				reason = err.Error()
+			}
+			fmt.Fprintf(os.Stderr, "Attempt %d/%d failed (%s), retrying in %s\n", attempt, attempts, reason, backoff)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// startBackgroundRefresh launches a detached kasher process that refreshes the
+// task's cache without printing anything.
+func startBackgroundRefresh(taskName string, args []string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	childArgs := []string{"--background-refresh"}
+	if commandTimeout != "" {
+		childArgs = append(childArgs, "--timeout", commandTimeout)
+	}
+	childArgs = append(childArgs, "--", taskName)
+	childArgs = append(childArgs, args...)
+	child := exec.Command(self, childArgs...)
+	child.SysProcAttr = detachedProcAttr()
+	// Stdin, Stdout and Stderr are left nil so the child is attached to the null device
+	if err := child.Start(); err != nil {
+		return err
+	}
+	return child.Process.Release()
+}
+
+// executeCommand runs the shell command, capturing stdout and stderr separately
+// for the cache. When stream is set the output is also passed through to the terminal.
+// A command running longer than the task's timeout is killed along with its process group.
+// An error is only returned if the command could not be run to completion; a non-zero
+// exit status is reported through the entry's ExitCode.
+func executeCommand(task config.TaskConfig, command string, stream bool) (config.CacheEntry, error) {
+	timeout := task.TimeoutDuration()
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+		// When the process group set up below doesn't receive the terminal's Ctrl-C
+		// (stdin is not a terminal), catch it here and kill the group ourselves.
+		ctx, cancel = signal.NotifyContext(ctx, os.Interrupt)
+		defer cancel()
+	}
+
+	var outBuf, errBuf bytes.Buffer
+	shell := exec.CommandContext(ctx, "sh", "-c", command)
+	shell.Dir = task.WorkDir()
+	shell.Stdout = &outBuf
+	shell.Stderr = &errBuf
+	if stream {
+		shell.Stdout = io.MultiWriter(os.Stdout, &outBuf)
+		shell.Stderr = io.MultiWriter(os.Stderr, &errBuf)
+	}
+	shell.Stdin = os.Stdin
+	if timeout > 0 {
+		restoreTerminal := setProcessGroup(shell)
+		defer restoreTerminal()
+		shell.WaitDelay = time.Second
+	}
+
+	start := time.Now()
+	err := shell.Run()
+	entry := config.CacheEntry{
+		Stdout:    outBuf.Bytes(),
+		Stderr:    errBuf.Bytes(),
+		Duration:  time.Since(start),
+		Timestamp: start,
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return entry, &timeoutError{timeout: timeout}
+	}
+	if ctx.Err() != nil {
+		return entry, errInterrupted
+	}
+	var exitErr *exec.ExitError
+	if sig, ok := exitSignal(err); ok && sig == syscall.SIGINT {
+		// Ctrl-C went straight to a command in the terminal's foreground group
+		return entry, errInterrupted
+	}
+	if errors.As(err, &exitErr) {
+		entry.ExitCode = exitErr.ExitCode()
+		if entry.ExitCode < 0 {
+			// Killed by a signal
+			entry.ExitCode = 1
+		}
+		if verbose {
+			fmt.Fprintf(os.Stderr, "Command exited with status %d\n", entry.ExitCode)
+		}
+		return entry, nil
+	}
+	if err != nil {
+		return entry, fmt.Errorf("error running command: %w", err)
+	}
+	return entry, nil
+}
+
+// exitSignal returns the signal that killed a command, if any.
+func exitSignal(err error) (syscall.Signal, bool) {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return 0, false
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return 0, false
+	}
+	return status.Signal(), true
+}
+
+// serveCached answers a run from cache, counting it as a cache hit. With --changed-only
+// cached output is never new, so nothing is printed.
+func serveCached(stateKey, cacheKey string, entry config.CacheEntry) error {
+	_ = config.TouchCache(cacheKey)
+	_ = config.UpdateTaskState(stateKey, func(state *config.TaskState) {
+		state.Hits++
+	})
+	if changedOnly {
+		return exitStatus(exitCodeUnchanged)
+	}
+	return replayEntry(entry)
+}
+
+// replayEntry writes a cached entry to stdout and stderr and returns its exit status.
+func replayEntry(entry config.CacheEntry) error {
+	os.Stdout.Write(entry.Stdout)
+	os.Stderr.Write(entry.Stderr)
+	return exitStatus(entry.ExitCode)
+}
+
+// exitStatus converts a task exit code into the error returned from the run path.
+func exitStatus(code int) error {
+	if code == 0 {
+		return nil
+	}
+	return &exitError{code: code}
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"kasher/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+var showCached bool
+
+var showCmd = &cobra.Command{
+	Use:   "show <name> [args...]",
+	Short: "Show a task's settings and cache state",
+	Long: `Show every setting of a task, where its cache is stored and what the cache holds.
+For tasks that take arguments, pass them after the name to inspect the cache of that run.
+Nothing is executed and the task's state is left untouched.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return err
+		}
+		taskName := args[0]
+		task, exists := cfg[taskName]
+		if !exists {
+			return fmt.Errorf("task '%s' does not exist", taskName)
+		}
+		// Without the arguments it needs the task's settings are still shown,
+		// but there is no cache entry to inspect
+		command, renderErr := task.RenderCommand(args[1:])
+		cacheKey := task.CacheKeyFor(taskName, command)
+
+		if showCached {
+			if renderErr != nil {
+				return fmt.Errorf("task '%s': %w", taskName, renderErr)
+			}
+			entry, err := config.ReadCache(cacheKey)
+			if err != nil {
+				return fmt.Errorf("no cached output for task '%s'", taskName)
+			}
+			os.Stdout.Write(entry.Stdout)
+			os.Stderr.Write(entry.Stderr)
+			return nil
+		}
+
+		state, err := config.LoadState()
+		if err != nil {
+			return fmt.Errorf("failed to load state: %w", err)
+		}
+		taskState := state[task.StateKey(taskName)]
+		status := inspectTask(taskName, task, args[1:], taskState, time.Now())
+		cachePath, err := config.GetCacheFilePath(cacheKey)
+		if err != nil {
+			return err
+		}
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(writer, "Task:\t%s\n", taskName)
+		if task.IsProjectTask() {
+			fmt.Fprintf(writer, "Defined in:\t%s\n", task.Origin)
+		} else if configPath, err := config.GetConfigPath(); err == nil {
+			fmt.Fprintf(writer, "Defined in:\t%s\n", configPath)
+		}
+		if renderErr == nil && command != task.Command {
+			fmt.Fprintf(writer, "Rendered command:\t%s\n", command)
+		}
+
+		fmt.Fprintln(writer, "\nSettings:")
+		for _, setting := range taskSettings(task) {
+			fmt.Fprintf(writer, "  %s:\t%s\n", setting[0], setting[1])
+		}
+
+		fmt.Fprintln(writer, "\nCache:")
+		if renderErr != nil {
+			fmt.Fprintf(writer, "  %v; pass arguments after the task name to inspect its cache\n", renderErr)
+			return writer.Flush()
+		}
+		fmt.Fprintf(writer, "  key:\t%s\n", cacheKey)
+		fmt.Fprintf(writer, "  file:\t%s\n", cachePath)
+		fmt.Fprintf(writer, "  status:\t%s\n", status.Status)
+		if entry, err := config.ReadCache(cacheKey); err == nil {
+			fmt.Fprintf(writer, "  fetched:\t%s (%s ago)\n", entry.Timestamp.Local().Format(time.DateTime), formatSeconds(*status.AgeSeconds))
+			if status.ExpiresAt != nil {
+				expires := "in " + formatSeconds(*status.ExpiresInSeconds)
+				if *status.ExpiresInSeconds < 0 {
+					expires = formatSeconds(-*status.ExpiresInSeconds) + " ago"
+				}
+				fmt.Fprintf(writer, "  expires:\t%s (%s)\n", status.ExpiresAt.Local().Format(time.DateTime), expires)
+			}
+			size := formatBytes(status.CacheSize)
+			if entry.Compression != "" {
+				size += " (" + entry.Compression + " compressed)"
+			}
+			fmt.Fprintf(writer, "  size:\t%s\n", size)
+			fmt.Fprintf(writer, "  stdout:\t%s\n", formatBytes(int64(len(entry.Stdout))))
+			fmt.Fprintf(writer, "  stderr:\t%s\n", formatBytes(int64(len(entry.Stderr))))
+			fmt.Fprintf(writer, "  exit code:\t%d\n", entry.ExitCode)
+			fmt.Fprintf(writer, "  duration:\t%s\n", entry.Duration.Round(time.Millisecond))
+			if entry.WatchDigest != "" {
+				fmt.Fprintf(writer, "  watched files digest:\t%s\n", entry.WatchDigest)
+			}
+		}
+
+		fmt.Fprintln(writer, "\nState:")
+		lastFetched := "never"
+		if !taskState.LastFetched.IsZero() {
+			lastFetched = taskState.LastFetched.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(writer, "  last fetched:\t%s\n", lastFetched)
+		if taskState.Runs > 0 {
+			fmt.Fprintf(writer, "  last exit code:\t%d\n", taskState.LastExitCode)
+			fmt.Fprintf(writer, "  last duration:\t%s\n", taskState.LastDuration)
+		}
+		fmt.Fprintf(writer, "  runs:\t%d\n", taskState.Runs)
+		fmt.Fprintf(writer, "  cache hits:\t%d\n", taskState.Hits)
+		return writer.Flush()
+	},
+}
+
+func init() {
+	showCmd.Flags().BoolVar(&showCached, "cached", false, "Print the cached output instead, without running the command")
+}
+
+// taskSettings lists every setting of a task as name and value pairs, describing
+// the defaults that apply to unset ones.
+func taskSettings(task config.TaskConfig) [][2]string {
+	orDefault := func(value, fallback string) string {
+		if value == "" {
+			return fallback
+		}
+		return value
+	}
+	var params []string
+	for name, value := range task.Params {
+		params = append(params, name+"="+value)
+	}
+	sort.Strings(params)
+	var retryOn []string
+	for _, code := range task.RetryOnExitCodes {
+		retryOn = append(retryOn, strconv.Itoa(code))
+	}
+	history := "(global setting)"
+	if task.History > 0 {
+		history = strconv.Itoa(task.History) + " runs"
+	}
+	return [][2]string{
+		{"command", task.Command},
+		{"expiration", orDefault(task.Expiration, "(none, never cached)")},
+		{"notes", orDefault(task.Notes, "-")},
+		{"params", orDefault(strings.Join(params, ", "), "-")},
+		{"cacheOn", orDefault(task.CacheOn, config.CacheOnSuccess+" (default)")},
+		{"keepLastGood", strconv.FormatBool(task.KeepLastGood)},
+		{"staleWhileRevalidate", orDefault(task.StaleWhileRevalidate, "-")},
+		{"staleIfError", orDefault(task.StaleIfError, "-")},
+		{"timeout", orDefault(task.Timeout, "(none)")},
+		{"retries", strconv.Itoa(task.Retries)},
+		{"retryBackoff", orDefault(task.RetryBackoff, task.RetryBackoffDuration().String()+" (default)")},
+		{"retryOnExitCodes", orDefault(strings.Join(retryOn, ", "), "(any result that isn't cached)")},
+		{"cacheKeyEnv", orDefault(strings.Join(task.CacheKeyEnv, ", "), "-")},
+		{"cacheKeyCwd", strconv.FormatBool(task.CacheKeyCwd)},
+		{"watchFiles", orDefault(strings.Join(task.WatchFiles, ", "), "-")},
+		{"maxCacheSize", orDefault(task.MaxCacheSize, "(no limit)")},
+		{"compression", orDefault(task.Compression, "(global setting)")},
+		{"history", history},
+		{"onChange", orDefault(task.OnChange, "-")},
+	}
+}
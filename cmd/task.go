@@ -4,8 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"kasher/internal/config"
 
@@ -21,11 +22,28 @@ func init() {
 	taskCmd.AddCommand(createCmd)
 	taskCmd.AddCommand(createForCmd)
 	taskCmd.AddCommand(updateCmd)
+	taskCmd.AddCommand(editCmd)
+	taskCmd.AddCommand(renameCmd)
+	taskCmd.AddCommand(copyCmd)
 	taskCmd.AddCommand(deleteCmd)
 	taskCmd.AddCommand(listCmd)
+	taskCmd.AddCommand(showCmd)
 	taskCmd.AddCommand(clearAllCmd)
+	taskCmd.AddCommand(restoreConfigCmd)
+	taskCmd.AddCommand(exportCmd)
+	taskCmd.AddCommand(importCmd)
 
 	taskCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Show extra information")
+
+	addTaskFlags(createCmd, &createFlags, true)
+	addTaskFlags(updateCmd, &updateFlags, true)
+	addTaskFlags(createForCmd, &createForFlags, false)
+}
+
+// projectTaskError explains that a task from a project task file can't be changed
+// through kasher.
+func projectTaskError(taskName string, task config.TaskConfig) error {
+	return fmt.Errorf("task '%s' is defined in %s; edit that file to change it", taskName, task.Origin)
 }
 
 // getCacheDir returns the kasher cache directory path
@@ -43,6 +61,11 @@ func printVerboseInfo() {
 		fmt.Println("Kasher config file location:")
 		fmt.Println(configPath)
 	}
+	settingsPath, err := config.GetSettingsPath()
+	if err == nil {
+		fmt.Println("Kasher settings file location:")
+		fmt.Println(settingsPath)
+	}
 	cacheDir, err := getCacheDir()
 	if err == nil {
 		fmt.Println("Kasher cache directory:")
@@ -50,10 +73,14 @@ func printVerboseInfo() {
 	}
 }
 
+var createFlags, updateFlags, createForFlags taskFlags
+
 var createCmd = &cobra.Command{
 	Use:   "create [name]",
 	Short: "Create a new task",
-	Args:  cobra.RangeArgs(0, 1),
+	Long: `Create a new task. Without flags the task details are prompted for.
+Passing any task setting as a flag (e.g. --command, --expiration) skips the prompts entirely.`,
+	Args: cobra.RangeArgs(0, 1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if verbose {
 			printVerboseInfo()
@@ -62,45 +89,122 @@ var createCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		fmt.Println("** Type '?' for help, 'q' to quit at any prompt **")
-		var taskName string
+		taskName := createFlags.name
 		if len(args) > 0 {
 			taskName = args[0]
-			if isReservedTaskName(taskName) {
-				return fmt.Errorf("the name '%s' is reserved and cannot be used. Please choose another name", taskName)
+		}
+		if createFlags.hasDetails(cmd) {
+			if taskName == "" {
+				return fmt.Errorf("a task name is required (use --name)")
+			}
+			if taskName, err = normalizeTaskName(cfg, taskName); err != nil {
+				return err
 			}
-			if _, exists := cfg[taskName]; exists {
-				return fmt.Errorf("task '%s' already exists", taskName)
+			var task config.TaskConfig
+			if err := createFlags.apply(cmd, &task); err != nil {
+				return err
+			}
+			return saveNewTask(taskName, task)
+		}
+
+		fmt.Println("** Type '?' for help, 'q' to quit at any prompt **")
+		if taskName != "" {
+			if taskName, err = normalizeTaskName(cfg, taskName); err != nil {
+				return err
 			}
-			// Optionally, validate/normalize taskName as PromptForTaskName would
 		} else {
-			var err error
 			taskName, err = PromptForTaskName(cfg, "Enter a name for the new task:")
 			if err != nil {
 				return err
 			}
-			if _, exists := cfg[taskName]; exists {
-				return fmt.Errorf("task '%s' already exists", taskName)
-			}
 		}
 		task, err := PromptTaskDetails(&config.TaskConfig{}, false)
 		if err != nil {
 			return err
 		}
-		if err := cfg.AddTask(taskName, task); err != nil {
+		return saveNewTask(taskName, task)
+	},
+}
+
+// saveNewTask adds the task to the config file.
+func saveNewTask(taskName string, task config.TaskConfig) error {
+	err := config.UpdateConfig(func(cfg config.KasherConfig) error {
+		return cfg.AddTask(taskName, task)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Task '%s' created.\n", taskName)
+	return nil
+}
+
+var updateCmd = &cobra.Command{
+	Use:   "update [name]",
+	Short: "Update an existing task",
+	Long: `Update an existing task. Without flags the task details are prompted for.
+Passing any task setting as a flag changes just those settings without prompting.`,
+	Args: cobra.RangeArgs(0, 1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if verbose {
+			printVerboseInfo()
+		}
+		cfg, err := config.LoadConfig()
+		if err != nil {
 			return err
 		}
-		if err := config.SaveConfig(cfg); err != nil {
+		taskName := updateFlags.name
+		if len(args) > 0 {
+			taskName = args[0]
+		}
+		if taskName == "" {
+			if updateFlags.hasDetails(cmd) {
+				return fmt.Errorf("a task name is required (use --name)")
+			}
+			taskName, err = PromptTaskName(cfg, "Select a task to update:")
+			if err != nil {
+				return err
+			}
+		}
+		existing, exists := cfg[taskName]
+		if !exists {
+			return fmt.Errorf("task '%s' does not exist", taskName)
+		}
+		if existing.IsProjectTask() {
+			return projectTaskError(taskName, existing)
+		}
+
+		var task config.TaskConfig
+		if updateFlags.hasDetails(cmd) {
+			task = existing
+			if err := updateFlags.apply(cmd, &task); err != nil {
+				return err
+			}
+		} else {
+			task, err = PromptTaskDetails(&existing, false)
+			if err != nil {
+				return err
+			}
+		}
+		err = config.UpdateConfig(func(cfg config.KasherConfig) error {
+			return cfg.UpdateTask(taskName, task)
+		})
+		if err != nil {
 			return err
 		}
-		fmt.Printf("Task '%s' created.\n", taskName)
+		// The new details may change what the command returns, so refresh on next run
+		_ = config.UpdateTaskState(taskName, func(state *config.TaskState) {
+			state.LastFetched = time.Time{}
+		})
+		fmt.Printf("Task '%s' updated.\n", taskName)
 		return nil
 	},
 }
 
-var updateCmd = &cobra.Command{
-	Use:   "update",
-	Short: "Update an existing task",
+var renameCmd = &cobra.Command{
+	Use:     "rename <old> <new>",
+	Aliases: []string{"mv"},
+	Short:   "Rename a task, keeping its cache and run history",
+	Args:    cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if verbose {
 			printVerboseInfo()
@@ -109,29 +213,94 @@ var updateCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		taskName, err := PromptTaskName(cfg, "Select a task to update:")
+		oldName := args[0]
+		task, exists := cfg[oldName]
+		if !exists {
+			return fmt.Errorf("task '%s' does not exist", oldName)
+		}
+		if task.IsProjectTask() {
+			return projectTaskError(oldName, task)
+		}
+		newName, err := normalizeTaskName(cfg, args[1])
 		if err != nil {
 			return err
 		}
-		existing := cfg[taskName]
-		task, err := PromptTaskDetails(&existing, false)
+		err = config.UpdateConfig(func(cfg config.KasherConfig) error {
+			return cfg.RenameTask(oldName, newName)
+		})
 		if err != nil {
 			return err
 		}
-		if err := cfg.UpdateTask(taskName, task); err != nil {
+		if err := config.MoveTaskCache(oldName, newName); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to move the cache of task '%s': %v\n", oldName, err)
+		}
+		_ = config.UpdateState(func(state config.State) error {
+			if taskState, ok := state[oldName]; ok {
+				state[newName] = taskState
+				delete(state, oldName)
+			}
+			return nil
+		})
+		fmt.Printf("Task '%s' renamed to '%s'.\n", oldName, newName)
+		return nil
+	},
+}
+
+var copyCmd = &cobra.Command{
+	Use:     "copy <src> <dst>",
+	Aliases: []string{"cp"},
+	Short:   "Duplicate a task along with its cache",
+	Long: `Duplicate a task under a new name, along with its cache and run history.
+Copying a project task adds it to the global config; its cache is not copied.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if verbose {
+			printVerboseInfo()
+		}
+		cfg, err := config.LoadConfig()
+		if err != nil {
 			return err
 		}
-		if err := config.SaveConfig(cfg); err != nil {
+		srcName := args[0]
+		task, exists := cfg[srcName]
+		if !exists {
+			return fmt.Errorf("task '%s' does not exist", srcName)
+		}
+		dstName, err := normalizeTaskName(cfg, args[1])
+		if err != nil {
 			return err
 		}
-		fmt.Printf("Task '%s' updated.\n", taskName)
+		if task.IsProjectTask() {
+			task.Origin = ""
+			if err := saveNewTask(dstName, task); err != nil {
+				return err
+			}
+			fmt.Printf("Copied from project task '%s'; its cache was not copied.\n", srcName)
+			return nil
+		}
+		err = config.UpdateConfig(func(cfg config.KasherConfig) error {
+			return cfg.CopyTask(srcName, dstName)
+		})
+		if err != nil {
+			return err
+		}
+		if err := config.CopyTaskCache(srcName, dstName); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to copy the cache of task '%s': %v\n", srcName, err)
+		}
+		_ = config.UpdateState(func(state config.State) error {
+			if taskState, ok := state[srcName]; ok {
+				state[dstName] = taskState
+			}
+			return nil
+		})
+		fmt.Printf("Task '%s' copied to '%s'.\n", srcName, dstName)
 		return nil
 	},
 }
 
 var deleteCmd = &cobra.Command{
 	Use:   "delete",
-	Short: "Delete a task",
+	Short: "Delete a task and its cache",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if verbose {
 			printVerboseInfo()
@@ -144,12 +313,22 @@ var deleteCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		if err := cfg.DeleteTask(taskName); err != nil {
-			return err
+		if cfg[taskName].IsProjectTask() {
+			return projectTaskError(taskName, cfg[taskName])
 		}
-		if err := config.SaveConfig(cfg); err != nil {
+		err = config.UpdateConfig(func(cfg config.KasherConfig) error {
+			return cfg.DeleteTask(taskName)
+		})
+		if err != nil {
 			return err
 		}
+		if err := config.RemoveTaskCache(taskName); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to remove the cache of task '%s': %v\n", taskName, err)
+		}
+		_ = config.UpdateState(func(state config.State) error {
+			delete(state, taskName)
+			return nil
+		})
 		fmt.Printf("Task '%s' deleted.\n", taskName)
 		return nil
 	},
@@ -157,13 +336,13 @@ var deleteCmd = &cobra.Command{
 
 var clearAllCmd = &cobra.Command{
 	Use:   "clearAll",
-	Short: "Delete all tasks settings",
+	Short: "Delete all tasks settings and their caches",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if verbose {
 			printVerboseInfo()
 		}
 		var confirm string
-		fmt.Print("Are you sure you want to delete all tasks and clear the config? (y/N): ")
+		fmt.Print("Are you sure you want to delete all tasks, their cached output and clear the config? (y/N): ")
 		fmt.Scanln(&confirm)
 		if confirm == "y" || confirm == "Y" {
 			if err := config.ClearConfig(); err != nil {
@@ -177,37 +356,40 @@ var clearAllCmd = &cobra.Command{
 	},
 }
 
-var listCmd = &cobra.Command{
-	Use:   "list",
-	Short: "List all tasks",
+var restoreConfigCmd = &cobra.Command{
+	Use:     "restoreConfig [backup]",
+	Aliases: []string{"restore-config"},
+	Short:   "Roll the config back to a previous version",
+	Long:    "Restore one of the last saved versions of the config file. Backup 1 is the most recent.",
+	Args:    cobra.RangeArgs(0, 1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if verbose {
 			printVerboseInfo()
 		}
-		cfg, err := config.LoadConfig()
+		backups, err := config.ListConfigBackups()
 		if err != nil {
 			return err
 		}
-		if len(cfg) == 0 {
-			fmt.Println("No tasks found.")
+		if len(backups) == 0 {
+			fmt.Println("No config backups found.")
 			return nil
 		}
-		fmt.Println("Tasks:")
-
-		// Get sorted task names for consistent ordering
-		var names []string
-		for name := range cfg {
-			names = append(names, name)
-		}
-		sort.Strings(names)
-
-		for _, name := range names {
-			task := cfg[name]
-			fmt.Printf("- %s: %s (expires: %s)\n", name, task.Command, task.Expiration)
-			if task.Notes != "" {
-				fmt.Printf("    Notes: %s\n", task.Notes)
+		var index int
+		if len(args) > 0 {
+			index, err = strconv.Atoi(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid backup number '%s'", args[0])
+			}
+		} else {
+			index, err = PromptConfigBackup(backups)
+			if err != nil {
+				return err
 			}
 		}
+		if err := config.RestoreConfigBackup(index); err != nil {
+			return err
+		}
+		fmt.Printf("Config restored from backup %d.\n", index)
 		return nil
 	},
 }
@@ -215,7 +397,9 @@ var listCmd = &cobra.Command{
 var createForCmd = &cobra.Command{
 	Use:   "createFor <command>",
 	Short: "Create a new task for a given shell command",
-	Args:  cobra.MinimumNArgs(1),
+	Long: `Create a new task for a given shell command. The name and remaining details are
+prompted for unless --name and at least one task setting flag (e.g. --expiration) are given.`,
+	Args: cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if verbose {
 			printVerboseInfo()
@@ -224,26 +408,43 @@ var createForCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		taskName, err := PromptForTaskName(cfg, "Enter a name for the new task:")
-		if err != nil {
-			return err
-		}
-		if _, exists := cfg[taskName]; exists {
-			return fmt.Errorf("task '%s' already exists", taskName)
-		}
 		if len(args) > 1 {
 			fmt.Println("Warning: It looks like you passed multiple arguments. If your command contains spaces, pipes, or shell operators (like &&), you should quote the command, e.g.:\n  kasher task createFor \"echo starting && sleep 5 && echo ending\"")
 		}
 		// Join all args as the shell command
 		shellCommand := strings.Join(args, " ")
-		task, err := PromptTaskDetails(&config.TaskConfig{Command: shellCommand}, true)
-		if err != nil {
-			return err
-		}
-		if err := cfg.AddTask(taskName, task); err != nil {
-			return err
+
+		var taskName string
+		var task config.TaskConfig
+		if createForFlags.hasDetails(cmd) {
+			if createForFlags.name == "" {
+				return fmt.Errorf("a task name is required (use --name)")
+			}
+			if taskName, err = normalizeTaskName(cfg, createForFlags.name); err != nil {
+				return err
+			}
+			task.Command = shellCommand
+			if err := createForFlags.apply(cmd, &task); err != nil {
+				return err
+			}
+		} else {
+			if createForFlags.name != "" {
+				taskName, err = normalizeTaskName(cfg, createForFlags.name)
+			} else {
+				taskName, err = PromptForTaskName(cfg, "Enter a name for the new task:")
+			}
+			if err != nil {
+				return err
+			}
+			task, err = PromptTaskDetails(&config.TaskConfig{Command: shellCommand}, true)
+			if err != nil {
+				return err
+			}
 		}
-		if err := config.SaveConfig(cfg); err != nil {
+		err = config.UpdateConfig(func(cfg config.KasherConfig) error {
+			return cfg.AddTask(taskName, task)
+		})
+		if err != nil {
 			return err
 		}
 		fmt.Printf("Task '%s' created for command: %s\n", taskName, shellCommand)
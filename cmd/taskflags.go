@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"kasher/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+// taskFlags holds the flags that set task details without prompting, so tasks can
+// be created and updated from scripts.
+type taskFlags struct {
+	name                 string
+	command              string
+	expiration           string
+	notes                string
+	params               map[string]string
+	cacheOn              string
+	keepLastGood         bool
+	staleWhileRevalidate string
+	staleIfError         string
+	timeout              string
+	retries              int
+	retryBackoff         string
+	retryOnExitCodes     []int
+	cacheKeyEnv          []string
+	cacheKeyCwd          bool
+	watchFiles           []string
+	maxCacheSize         string
+	compression          string
+	history              int
+	onChange             string
+}
+
+// taskDetailFlags lists the flags that set a task setting, as opposed to its name.
+var taskDetailFlags = []string{
+	"command", "expiration", "notes", "param", "cache-on", "keep-last-good",
+	"stale-while-revalidate", "stale-if-error", "timeout", "retries", "retry-backoff",
+	"retry-on-exit-codes", "cache-key-env", "cache-key-cwd", "watch-files", "max-cache-size", "compression",
+	"history", "on-change",
+}
+
+// addTaskFlags registers the task flags on cmd. The --command flag is left out for
+// commands that take the shell command as arguments.
+func addTaskFlags(cmd *cobra.Command, f *taskFlags, withCommand bool) {
+	flags := cmd.Flags()
+	flags.StringVar(&f.name, "name", "", "Task name")
+	if withCommand {
+		flags.StringVar(&f.command, "command", "", "Shell command to run")
+	}
+	flags.StringVar(&f.expiration, "expiration", "", "Cache expiration: a duration (e.g. 10m, 1h), a cron expression or descriptor (e.g. \"0 9 * * *\", @hourly) or \"at HH:MM\"")
+	flags.StringVar(&f.notes, "notes", "", "Notes for the task")
+	flags.StringToStringVar(&f.params, "param", nil, "Default for a command parameter as name=value (repeatable)")
+	flags.StringVar(&f.cacheOn, "cache-on", "", "Which runs to cache: success, always or a list of exit codes")
+	flags.BoolVar(&f.keepLastGood, "keep-last-good", false, "Show the last cached result when a refresh fails")
+	flags.StringVar(&f.staleWhileRevalidate, "stale-while-revalidate", "", "How long past expiration to serve cache while refreshing in the background")
+	flags.StringVar(&f.staleIfError, "stale-if-error", "", "How long past expiration to serve cache when a refresh fails")
+	flags.StringVar(&f.timeout, "timeout", "", "Kill the command if it runs longer than this duration")
+	flags.IntVar(&f.retries, "retries", 0, "How many times to retry a failed command")
+	flags.StringVar(&f.retryBackoff, "retry-backoff", "", "Delay before the first retry, doubled after each attempt")
+	flags.IntSliceVar(&f.retryOnExitCodes, "retry-on-exit-codes", nil, "Exit codes to retry on (default: any result that isn't cached)")
+	flags.StringSliceVar(&f.cacheKeyEnv, "cache-key-env", nil, "Environment variables whose values get separate cache entries (e.g. KUBECONFIG,AWS_PROFILE)")
+	flags.BoolVar(&f.cacheKeyCwd, "cache-key-cwd", false, "Keep a separate cache entry for each working directory")
+	flags.StringSliceVar(&f.watchFiles, "watch-files", nil, "Glob patterns of files whose changes expire the cache (e.g. go.mod,go.sum)")
+	flags.StringVar(&f.maxCacheSize, "max-cache-size", "", "Don't cache output larger than this size (e.g. 10MB)")
+	flags.StringVar(&f.compression, "compression", "", "Compress cached output: gzip, zstd or none (default: the global setting)")
+	flags.IntVar(&f.history, "history", 0, "How many past outputs to keep for 'kasher history' and 'kasher diff' (default: the global setting)")
+	flags.StringVar(&f.onChange, "on-change", "", "Shell command to run when a refresh caches different output")
+}
+
+// hasDetails reports whether any flag setting a task detail was passed. When one is,
+// the command runs without prompting.
+func (f *taskFlags) hasDetails(cmd *cobra.Command) bool {
+	for _, name := range taskDetailFlags {
+		if flag := cmd.Flags().Lookup(name); flag != nil && flag.Changed {
+			return true
+		}
+	}
+	return false
+}
+
+// apply copies the flags that were passed onto task and validates the result.
+func (f *taskFlags) apply(cmd *cobra.Command, task *config.TaskConfig) error {
+	changed := cmd.Flags().Changed
+	if changed("command") {
+		task.Command = f.command
+	}
+	if changed("expiration") {
+		task.Expiration = f.expiration
+	}
+	if changed("notes") {
+		task.Notes = f.notes
+	}
+	if changed("param") {
+		if task.Params == nil {
+			task.Params = make(map[string]string)
+		}
+		for name, value := range f.params {
+			task.Params[name] = value
+		}
+	}
+	if changed("cache-on") {
+		task.CacheOn = f.cacheOn
+	}
+	if changed("keep-last-good") {
+		task.KeepLastGood = f.keepLastGood
+	}
+	if changed("stale-while-revalidate") {
+		task.StaleWhileRevalidate = f.staleWhileRevalidate
+	}
+	if changed("stale-if-error") {
+		task.StaleIfError = f.staleIfError
+	}
+	if changed("timeout") {
+		task.Timeout = f.timeout
+	}
+	if changed("retries") {
+		task.Retries = f.retries
+	}
+	if changed("retry-backoff") {
+		task.RetryBackoff = f.retryBackoff
+	}
+	if changed("retry-on-exit-codes") {
+		task.RetryOnExitCodes = f.retryOnExitCodes
+	}
+	if changed("cache-key-env") {
+		task.CacheKeyEnv = f.cacheKeyEnv
+	}
+	if changed("cache-key-cwd") {
+		task.CacheKeyCwd = f.cacheKeyCwd
+	}
+	if changed("watch-files") {
+		task.WatchFiles = f.watchFiles
+	}
+	if changed("max-cache-size") {
+		task.MaxCacheSize = f.maxCacheSize
+	}
+	if changed("compression") {
+		task.Compression = f.compression
+	}
+	if changed("history") {
+		task.History = f.history
+	}
+	if changed("on-change") {
+		task.OnChange = f.onChange
+	}
+
+	if task.Expiration == "" {
+		return errors.New("expiration is required (use --expiration)")
+	}
+	if err := task.Validate(); err != nil {
+		return fmt.Errorf("invalid task: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"kasher/internal/config"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/spf13/cobra"
+)
+
+// Strategies for tasks that are imported under a name that is already in use.
+const (
+	conflictSkip      = "skip"
+	conflictOverwrite = "overwrite"
+	conflictRename    = "rename"
+)
+
+var exportFormat string
+var exportOutput string
+var importFormat string
+var importConflict string
+var importDryRun bool
+
+var exportCmd = &cobra.Command{
+	Use:   "export [names...]",
+	Short: "Export task definitions as TOML, YAML or JSON",
+	Long: `Export task definitions, without any runtime state, so they can be shared.
+All tasks are exported unless names are given. The format defaults to the
+extension of --output, or TOML.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return err
+		}
+		selected := cfg
+		if len(args) > 0 {
+			selected = make(config.KasherConfig)
+			for _, name := range args {
+				task, exists := cfg[name]
+				if !exists {
+					return fmt.Errorf("task '%s' does not exist", name)
+				}
+				selected[name] = task
+			}
+		}
+
+		format := exportFormat
+		if format == "" {
+			format = config.FormatFromPath(exportOutput)
+		}
+		if format == "" {
+			format = config.FormatTOML
+		}
+		data, err := config.MarshalTasks(selected, format)
+		if err != nil {
+			return err
+		}
+		if exportOutput == "" || exportOutput == "-" {
+			_, err = os.Stdout.Write(data)
+			return err
+		}
+		if err := os.WriteFile(exportOutput, data, 0o644); err != nil {
+			return err
+		}
+		fmt.Printf("Exported %d tasks to %s\n", len(selected), exportOutput)
+		return nil
+	},
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import <file|->",
+	Short: "Import task definitions from a TOML, YAML or JSON file",
+	Long: `Import task definitions from a file, or from stdin with "-".
+The format defaults to the file extension, or TOML.
+Tasks whose name is already in use are skipped, overwritten or imported under a
+new name depending on --on-conflict. Use --dry-run to see the changes without saving them.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if verbose {
+			printVerboseInfo()
+		}
+		switch importConflict {
+		case conflictSkip, conflictOverwrite, conflictRename:
+		default:
+			return fmt.Errorf("invalid --on-conflict %q (expected %s, %s or %s)", importConflict, conflictSkip, conflictOverwrite, conflictRename)
+		}
+
+		var data []byte
+		var err error
+		if args[0] == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(args[0])
+		}
+		if err != nil {
+			return err
+		}
+		format := importFormat
+		if format == "" {
+			format = config.FormatFromPath(args[0])
+		}
+		if format == "" {
+			format = config.FormatTOML
+		}
+		incoming, err := config.UnmarshalTasks(data, format)
+		if err != nil {
+			return err
+		}
+		for name, task := range incoming {
+			if err := validateEditedTask(name, task); err != nil {
+				return err
+			}
+		}
+
+		// Imports only ever change the global config, so plan against it alone
+		if importDryRun {
+			cfg, err := config.LoadGlobalConfig()
+			if err != nil {
+				return err
+			}
+			printImportPlan(planImport(cfg, incoming, importConflict))
+			fmt.Println("Dry run: no changes saved.")
+			return nil
+		}
+
+		var changes []importChange
+		err = config.UpdateConfig(func(cfg config.KasherConfig) error {
+			changes = planImport(cfg, incoming, importConflict)
+			for _, change := range changes {
+				if change.action != importSkip && change.action != importUnchanged {
+					cfg[change.name] = change.task
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// Overwritten tasks may return something else now, so refresh them on next run
+		for _, change := range changes {
+			if change.action == importOverwrite {
+				_ = config.UpdateTaskState(change.name, func(state *config.TaskState) {
+					state.LastFetched = time.Time{}
+				})
+			}
+		}
+		printImportPlan(changes)
+		imported := 0
+		for _, change := range changes {
+			if change.action != importSkip && change.action != importUnchanged {
+				imported++
+			}
+		}
+		fmt.Printf("Imported %d of %d tasks.\n", imported, len(changes))
+		return nil
+	},
+}
+
+func init() {
+	exportCmd.Flags().StringVar(&exportFormat, "format", "", "Output format: toml, yaml or json")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Write to this file instead of stdout")
+	importCmd.Flags().StringVar(&importFormat, "format", "", "Input format: toml, yaml or json")
+	importCmd.Flags().StringVar(&importConflict, "on-conflict", conflictSkip, "What to do with tasks whose name is taken: skip, overwrite or rename")
+	importCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "Show what would change without saving")
+}
+
+// Actions an import takes for a single task.
+const (
+	importAdd       = "new"
+	importOverwrite = "overwrite"
+	importSkip      = "exists, skipped"
+	importRename    = "new, renamed"
+	importUnchanged = "unchanged"
+)
+
+// importChange describes what importing a task does to the config.
+type importChange struct {
+	action   string
+	name     string // name the task is saved under
+	original string // name in the imported file
+	task     config.TaskConfig
+	existing config.TaskConfig
+}
+
+// planImport works out how the incoming tasks are merged into cfg.
+func planImport(cfg config.KasherConfig, incoming config.KasherConfig, onConflict string) []importChange {
+	var names []string
+	for name := range incoming {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Renamed tasks must not take the name of an existing task, nor of another
+	// incoming task, whether or not that one is imported
+	taken := make(map[string]bool)
+	for name := range cfg {
+		taken[name] = true
+	}
+	for name := range incoming {
+		taken[name] = true
+	}
+	var changes []importChange
+	for _, name := range names {
+		change := importChange{action: importAdd, name: name, original: name, task: incoming[name]}
+		if existing, exists := cfg[name]; exists {
+			change.existing = existing
+			switch {
+			case taskTOML(existing) == taskTOML(change.task):
+				change.action = importUnchanged
+			case onConflict == conflictOverwrite:
+				change.action = importOverwrite
+			case onConflict == conflictRename:
+				change.action = importRename
+				for i := 2; taken[change.name]; i++ {
+					change.name = fmt.Sprintf("%s-%d", name, i)
+				}
+			default:
+				change.action = importSkip
+			}
+		}
+		taken[change.name] = true
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// printImportPlan lists the changes an import makes, with the changed settings of
+// overwritten tasks.
+func printImportPlan(changes []importChange) {
+	for _, change := range changes {
+		switch change.action {
+		case importAdd:
+			fmt.Printf("+ %s (%s)\n", change.name, change.action)
+		case importRename:
+			fmt.Printf("+ %s (%s from '%s')\n", change.name, change.action, change.original)
+		case importOverwrite:
+			fmt.Printf("~ %s (%s)\n", change.name, change.action)
+			oldLines := strings.Split(taskTOML(change.existing), "\n")
+			newLines := strings.Split(taskTOML(change.task), "\n")
+			for _, line := range lineDifference(oldLines, newLines) {
+				fmt.Printf("    - %s\n", line)
+			}
+			for _, line := range lineDifference(newLines, oldLines) {
+				fmt.Printf("    + %s\n", line)
+			}
+		default:
+			fmt.Printf("= %s (%s)\n", change.name, change.action)
+		}
+	}
+}
+
+// taskTOML renders a single task's settings as TOML.
+func taskTOML(task config.TaskConfig) string {
+	data, err := toml.Marshal(task)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// lineDifference returns the non-empty lines of a that are not in b.
+func lineDifference(a, b []string) []string {
+	inB := make(map[string]bool)
+	for _, line := range b {
+		inB[line] = true
+	}
+	var diff []string
+	for _, line := range a {
+		if line != "" && !inB[line] {
+			diff = append(diff, line)
+		}
+	}
+	return diff
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"testing"
+
+	"kasher/internal/config"
+)
+
+func TestPlanImport(t *testing.T) {
+	task := func(command string) config.TaskConfig {
+		return config.TaskConfig{Command: command, Expiration: "1h"}
+	}
+	type planned struct{ action, name, original string }
+	tests := []struct {
+		name       string
+		existing   config.KasherConfig
+		incoming   config.KasherConfig
+		onConflict string
+		want       []planned
+	}{
+		{
+			name:       "new task",
+			existing:   config.KasherConfig{"a": task("echo a")},
+			incoming:   config.KasherConfig{"b": task("echo b")},
+			onConflict: conflictSkip,
+			want:       []planned{{importAdd, "b", "b"}},
+		},
+		{
+			name:       "identical task",
+			existing:   config.KasherConfig{"a": task("echo a")},
+			incoming:   config.KasherConfig{"a": task("echo a")},
+			onConflict: conflictOverwrite,
+			want:       []planned{{importUnchanged, "a", "a"}},
+		},
+		{
+			name:       "skip",
+			existing:   config.KasherConfig{"a": task("echo a")},
+			incoming:   config.KasherConfig{"a": task("echo A")},
+			onConflict: conflictSkip,
+			want:       []planned{{importSkip, "a", "a"}},
+		},
+		{
+			name:       "overwrite",
+			existing:   config.KasherConfig{"a": task("echo a")},
+			incoming:   config.KasherConfig{"a": task("echo A")},
+			onConflict: conflictOverwrite,
+			want:       []planned{{importOverwrite, "a", "a"}},
+		},
+		{
+			name:       "rename",
+			existing:   config.KasherConfig{"a": task("echo a")},
+			incoming:   config.KasherConfig{"a": task("echo A")},
+			onConflict: conflictRename,
+			want:       []planned{{importRename, "a-2", "a"}},
+		},
+		{
+			name:       "rename past existing suffixes",
+			existing:   config.KasherConfig{"a": task("echo a"), "a-2": task("echo a2")},
+			incoming:   config.KasherConfig{"a": task("echo A")},
+			onConflict: conflictRename,
+			want:       []planned{{importRename, "a-3", "a"}},
+		},
+		{
+			name:       "rename past incoming names",
+			existing:   config.KasherConfig{"slow": task("sleep 1")},
+			incoming:   config.KasherConfig{"slow": task("sleep 2"), "slow-2": task("sleep 3")},
+			onConflict: conflictRename,
+			want: []planned{
+				{importRename, "slow-3", "slow"},
+				{importAdd, "slow-2", "slow-2"},
+			},
+		},
+		{
+			name:       "rename past incoming names that are renamed too",
+			existing:   config.KasherConfig{"x": task("echo 1"), "x-2": task("echo 2")},
+			incoming:   config.KasherConfig{"x": task("echo 3"), "x-2": task("echo 4"), "x-3": task("echo 5")},
+			onConflict: conflictRename,
+			want: []planned{
+				{importRename, "x-4", "x"},
+				{importRename, "x-2-2", "x-2"},
+				{importAdd, "x-3", "x-3"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := planImport(tt.existing, tt.incoming, tt.onConflict)
+			if len(changes) != len(tt.want) {
+				t.Fatalf("planImport made %d changes, want %d: %+v", len(changes), len(tt.want), changes)
+			}
+			saved := make(map[string]bool)
+			for i, change := range changes {
+				got := planned{change.action, change.name, change.original}
+				if got != tt.want[i] {
+					t.Errorf("change %d = %+v, want %+v", i, got, tt.want[i])
+				}
+				if change.action == importSkip || change.action == importUnchanged {
+					continue
+				}
+				if saved[change.name] {
+					t.Errorf("two imported tasks are saved as %q", change.name)
+				}
+				saved[change.name] = true
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// configBackupCount is the number of previous config versions kept by SaveConfig.
+const configBackupCount = 5
+
+// ConfigBackup describes a previous version of the config file.
+type ConfigBackup struct {
+	Index   int // 1 is the most recent
+	Path    string
+	ModTime time.Time
+}
+
+// getBackupDir returns the directory holding config backups, creating it if needed.
+func getBackupDir() (string, error) {
+	path, err := getConfigPath()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(filepath.Dir(path), "backups")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// backupPath returns the path of the backup with the given index.
+func backupPath(dir string, index int) string {
+	return filepath.Join(dir, "config.toml."+strconv.Itoa(index))
+}
+
+// backupConfig keeps the current config file as the most recent backup before it is
+// replaced with data, shifting older backups down and dropping the oldest one.
+// Nothing is backed up if the file does not exist yet or is unchanged.
+func backupConfig(path string, data []byte) error {
+	current, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if bytes.Equal(current, data) {
+		return nil
+	}
+	// Backups get the config file's permissions, as commands may contain secrets
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	dir, err := getBackupDir()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(backupPath(dir, configBackupCount)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for i := configBackupCount - 1; i >= 1; i-- {
+		if err := os.Rename(backupPath(dir, i), backupPath(dir, i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return writeFileAtomic(backupPath(dir, 1), current, info.Mode().Perm())
+}
+
+// ListConfigBackups returns the available config backups, most recent first.
+func ListConfigBackups() ([]ConfigBackup, error) {
+	dir, err := getBackupDir()
+	if err != nil {
+		return nil, err
+	}
+	var backups []ConfigBackup
+	for i := 1; i <= configBackupCount; i++ {
+		path := backupPath(dir, i)
+		info, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		backups = append(backups, ConfigBackup{Index: i, Path: path, ModTime: info.ModTime()})
+	}
+	return backups, nil
+}
+
+// LoadConfigBackup parses the config backup with the given index.
+func LoadConfigBackup(index int) (KasherConfig, error) {
+	dir, err := getBackupDir()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(backupPath(dir, index))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("backup %d does not exist", index)
+	} else if err != nil {
+		return nil, err
+	}
+	var cfg KasherConfig
+	if err := toml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("backup %d is not a valid config: %w", index, err)
+	}
+	if cfg == nil {
+		cfg = make(KasherConfig)
+	}
+	return cfg, nil
+}
+
+// RestoreConfigBackup replaces the config file with the backup with the given index.
+// The config being replaced is itself kept as the most recent backup.
+func RestoreConfigBackup(index int) error {
+	dir, err := getBackupDir()
+	if err != nil {
+		return err
+	}
+	if _, err := LoadConfigBackup(index); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(backupPath(dir, index))
+	if err != nil {
+		return err
+	}
+	path, err := getConfigPath()
+	if err != nil {
+		return err
+	}
+	lock, err := LockConfig()
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if err := backupConfig(path, data); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0o644)
+}
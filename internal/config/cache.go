@@ -1,12 +1,63 @@
 package config
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
-// GetCacheFilePath returns the path to the cache file for a given task.
-func GetCacheFilePath(taskName string) (string, error) {
+// cacheMagic prefixes the metadata line of structured cache files.
+// Files without it are plain-text caches written by older versions of kasher.
+const cacheMagic = "KASHER1 "
+
+// CacheEntry is the cached result of a single task run.
+type CacheEntry struct {
+	Stdout    []byte
+	Stderr    []byte
+	ExitCode  int
+	Duration  time.Duration
+	Timestamp time.Time
+	// WatchDigest fingerprints the task's watched files when the entry was fetched
+	// (see TaskConfig.WatchDigest).
+	WatchDigest string
+	// Origin is the project task file of the task the entry was written for, so
+	// 'kasher cache prune' can tell whether it still exists. It is empty for global tasks.
+	Origin string
+	// Compression is how the output is compressed on disk (see CompressionGzip and
+	// CompressionZstd). It is empty for uncompressed entries.
+	Compression string
+}
+
+// SameOutput reports whether two entries hold the same output and exit code,
+// whenever and however they were stored.
+func (e CacheEntry) SameOutput(other CacheEntry) bool {
+	return e.ExitCode == other.ExitCode && bytes.Equal(e.Stdout, other.Stdout) && bytes.Equal(e.Stderr, other.Stderr)
+}
+
+// cacheHeader is the metadata stored on the first line of a cache file.
+// The stdout and stderr bodies follow it, compressed together if Compression is set.
+type cacheHeader struct {
+	ExitCode    int       `json:"exitCode"`
+	Duration    string    `json:"duration"`
+	Timestamp   time.Time `json:"timestamp"`
+	StdoutSize  int       `json:"stdoutSize"`
+	StderrSize  int       `json:"stderrSize"`
+	WatchDigest string    `json:"watchDigest,omitempty"`
+	Origin      string    `json:"origin,omitempty"`
+	Compression string    `json:"compression,omitempty"`
+}
+
+// GetCacheFilePath returns the path to the cache file for a given cache key.
+// For tasks without arguments the key is simply the task name (see CacheKey).
+func GetCacheFilePath(key string) (string, error) {
 	dir, err := os.UserCacheDir()
 	if err != nil {
 		return "", err
@@ -15,28 +66,256 @@ func GetCacheFilePath(taskName string) (string, error) {
 	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
 		return "", err
 	}
-	cachePath := filepath.Join(cacheDir, taskName+".cache")
+	cachePath := filepath.Join(cacheDir, key+".cache")
 	return cachePath, nil
 }
 
-// WriteCache saves the output to the cache file for the given task.
-func WriteCache(taskName, output string) error {
-	path, err := GetCacheFilePath(taskName)
+// WriteCache saves the entry to the cache file for the given cache key, compressing
+// its output as entry.Compression says.
+func WriteCache(key string, entry CacheEntry) error {
+	path, err := GetCacheFilePath(key)
+	if err != nil {
+		return err
+	}
+	data, err := encodeCacheEntry(entry)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, []byte(output), 0o644)
+	return writeFileAtomic(path, data, 0o644)
 }
 
-// ReadCache reads the cached output for the given task.
-func ReadCache(taskName string) (string, error) {
-	path, err := GetCacheFilePath(taskName)
+// encodeCacheEntry renders an entry in the cache file format.
+func encodeCacheEntry(entry CacheEntry) ([]byte, error) {
+	header, err := json.Marshal(cacheHeader{
+		ExitCode:    entry.ExitCode,
+		Duration:    entry.Duration.String(),
+		Timestamp:   entry.Timestamp,
+		StdoutSize:  len(entry.Stdout),
+		StderrSize:  len(entry.Stderr),
+		WatchDigest: entry.WatchDigest,
+		Origin:      entry.Origin,
+		Compression: entry.Compression,
+	})
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	body := append(append([]byte{}, entry.Stdout...), entry.Stderr...)
+	if entry.Compression != "" {
+		if body, err = compress(body, entry.Compression); err != nil {
+			return nil, err
+		}
 	}
+	var buf bytes.Buffer
+	buf.WriteString(cacheMagic)
+	buf.Write(header)
+	buf.WriteByte('\n')
+	buf.Write(body)
+	return buf.Bytes(), nil
+}
+
+// ReadCache reads the cached entry for the given cache key, decompressing its output
+// if it was stored compressed. Plain-text caches from older versions are returned as
+// stdout with exit code 0, timestamped with the file's modification time.
+func ReadCache(key string) (CacheEntry, error) {
+	path, err := GetCacheFilePath(key)
+	if err != nil {
+		return CacheEntry{}, err
+	}
+	return readCacheFile(path)
+}
+
+// readCacheFile reads a file in the cache file format.
+func readCacheFile(path string) (CacheEntry, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return "", err
+		return CacheEntry{}, err
+	}
+	if !bytes.HasPrefix(data, []byte(cacheMagic)) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return CacheEntry{}, err
+		}
+		return CacheEntry{Stdout: data, Timestamp: info.ModTime()}, nil
+	}
+	return parseCacheEntry(data)
+}
+
+// parseCacheEntry decodes a structured cache file.
+func parseCacheEntry(data []byte) (CacheEntry, error) {
+	buffered := bufio.NewReader(bytes.NewReader(data[len(cacheMagic):]))
+	line, err := buffered.ReadBytes('\n')
+	if err != nil {
+		return CacheEntry{}, fmt.Errorf("invalid cache file: %w", err)
+	}
+	var header cacheHeader
+	if err := json.Unmarshal(line, &header); err != nil {
+		return CacheEntry{}, fmt.Errorf("invalid cache file: %w", err)
+	}
+	if header.StdoutSize < 0 || header.StderrSize < 0 {
+		return CacheEntry{}, errors.New("invalid cache file: negative output size")
+	}
+	entry := CacheEntry{
+		ExitCode:    header.ExitCode,
+		Timestamp:   header.Timestamp,
+		WatchDigest: header.WatchDigest,
+		Origin:      header.Origin,
+		Compression: header.Compression,
+	}
+	entry.Duration, _ = time.ParseDuration(header.Duration)
+	var reader io.Reader = buffered
+	if header.Compression != "" {
+		decompressed, err := decompress(buffered, header.Compression)
+		if err != nil {
+			return CacheEntry{}, fmt.Errorf("invalid cache file: %w", err)
+		}
+		defer decompressed.Close()
+		reader = decompressed
+	}
+	// Read no more than the header announces, and only allocate what is actually there
+	body, err := io.ReadAll(io.LimitReader(reader, int64(header.StdoutSize)+int64(header.StderrSize)))
+	if err != nil {
+		return CacheEntry{}, fmt.Errorf("invalid cache file: %w", err)
+	}
+	if header.StdoutSize > len(body) || header.StderrSize != len(body)-header.StdoutSize {
+		return CacheEntry{}, errors.New("invalid cache file: output is shorter than its header says")
+	}
+	entry.Stdout = body[:header.StdoutSize:header.StdoutSize]
+	entry.Stderr = body[header.StdoutSize:]
+	return entry, nil
+}
+
+// TaskCacheKeys returns the keys of all cache entries of the named global task: its
+// plain key and the hashed keys of its argument and environment variants (see CacheKey).
+// Entries of project tasks with the same name are left out.
+func TaskCacheKeys(taskName string) ([]string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "kasher"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, entry := range entries {
+		key, ok := strings.CutSuffix(entry.Name(), ".cache")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		if isGlobalTaskKeyOf(key, taskName) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// isGlobalTaskKeyOf reports whether key is a cache key of the named global task.
+// Project tasks get hashed keys of the same shape as the argument and environment
+// variants of global tasks, so the origin recorded with the entry, or else with its
+// history, tells them apart.
+func isGlobalTaskKeyOf(key, taskName string) bool {
+	if key == taskName {
+		return true
+	}
+	if !isHashedKeyOf(key, taskName) {
+		return false
+	}
+	if path, err := GetCacheFilePath(key); err == nil {
+		if header, err := readCacheHeader(path); err == nil {
+			return header.Origin == ""
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return true // a plain-text cache of an older version, which only global tasks had
+		}
+	}
+	entries, _ := ListHistory(key)
+	for _, entry := range entries {
+		if header, err := readCacheHeader(entry.Path); err == nil {
+			return header.Origin == ""
+		}
+	}
+	return true
+}
+
+// isHashedKeyOf reports whether key is the task name followed by a hash suffix.
+func isHashedKeyOf(key, taskName string) bool {
+	suffix, ok := strings.CutPrefix(key, taskName+".")
+	if !ok || len(suffix) != cacheKeyHashLength {
+		return false
+	}
+	_, err := hex.DecodeString(suffix)
+	return err == nil
+}
+
+// MoveTaskCache moves all cache entries of a global task to a new task name,
+// replacing any entries already cached under that name.
+func MoveTaskCache(from, to string) error {
+	return transferTaskCache(from, to, true)
+}
+
+// CopyTaskCache copies all cache entries of a global task to another task name,
+// replacing any entries already cached under that name.
+func CopyTaskCache(from, to string) error {
+	return transferTaskCache(from, to, false)
+}
+
+func transferTaskCache(from, to string, move bool) error {
+	if err := RemoveTaskCache(to); err != nil {
+		return err
+	}
+	keys, err := TaskCacheKeys(from)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		oldPath, err := GetCacheFilePath(key)
+		if err != nil {
+			return err
+		}
+		newPath, err := GetCacheFilePath(to + strings.TrimPrefix(key, from))
+		if err != nil {
+			return err
+		}
+		if move {
+			err = os.Rename(oldPath, newPath)
+		} else {
+			var data []byte
+			if data, err = os.ReadFile(oldPath); err == nil {
+				err = writeFileAtomic(newPath, data, 0o644)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return transferTaskHistory(from, to, move)
+}
+
+// RemoveTaskCache deletes all cache entries of the named global task, along with
+// their history.
+func RemoveTaskCache(taskName string) error {
+	keys, err := TaskCacheKeys(taskName)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		path, err := GetCacheFilePath(key)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	historyKeys, err := taskHistoryKeys(taskName)
+	if err != nil {
+		return err
+	}
+	for _, key := range historyKeys {
+		if err := RemoveHistory(key); err != nil {
+			return err
+		}
 	}
-	return string(data), nil
+	return nil
 }
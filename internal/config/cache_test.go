@@ -0,0 +1,301 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCacheEntryRoundTrip(t *testing.T) {
+	timestamp := time.Date(2025, 3, 14, 9, 26, 53, 0, time.UTC)
+	tests := []struct {
+		name  string
+		entry CacheEntry
+	}{
+		{
+			name: "plain",
+			entry: CacheEntry{
+				Stdout:    []byte("NAME   READY\nweb-1  1/1\n"),
+				Stderr:    []byte("warning: deprecated\n"),
+				ExitCode:  0,
+				Duration:  1500 * time.Millisecond,
+				Timestamp: timestamp,
+			},
+		},
+		{
+			name:  "empty output",
+			entry: CacheEntry{Stdout: []byte{}, Stderr: []byte{}, Timestamp: timestamp},
+		},
+		{
+			name: "output with newlines only in stderr and binary stdout",
+			entry: CacheEntry{
+				Stdout:    []byte{0, 1, 2, '\n', 0xff},
+				Stderr:    []byte("line 1\nline 2\n"),
+				ExitCode:  3,
+				Timestamp: timestamp,
+			},
+		},
+		{
+			name: "metadata",
+			entry: CacheEntry{
+				Stdout:      []byte("ok\n"),
+				Stderr:      []byte{},
+				ExitCode:    1,
+				Duration:    time.Second,
+				Timestamp:   timestamp,
+				WatchDigest: "abc123",
+				Origin:      "/src/project/.kasher.toml",
+			},
+		},
+		{
+			name: "gzip",
+			entry: CacheEntry{
+				Stdout:      bytes.Repeat([]byte("compressible output\n"), 100),
+				Stderr:      []byte("stderr\n"),
+				Duration:    time.Minute,
+				Timestamp:   timestamp,
+				Compression: CompressionGzip,
+			},
+		},
+		{
+			name: "zstd",
+			entry: CacheEntry{
+				Stdout:      bytes.Repeat([]byte("compressible output\n"), 100),
+				Stderr:      []byte("stderr\n"),
+				ExitCode:    2,
+				Timestamp:   timestamp,
+				Compression: CompressionZstd,
+			},
+		},
+		{
+			name:  "zstd with empty output",
+			entry: CacheEntry{Stdout: []byte{}, Stderr: []byte{}, Timestamp: timestamp, Compression: CompressionZstd},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := encodeCacheEntry(tt.entry)
+			if err != nil {
+				t.Fatalf("encodeCacheEntry: %v", err)
+			}
+			if !bytes.HasPrefix(data, []byte(cacheMagic)) {
+				t.Fatalf("encoded entry does not start with %q", cacheMagic)
+			}
+			path := filepath.Join(t.TempDir(), "task.cache")
+			if err := os.WriteFile(path, data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readCacheFile(path)
+			if err != nil {
+				t.Fatalf("readCacheFile: %v", err)
+			}
+			assertEntry(t, got, tt.entry)
+		})
+	}
+}
+
+func TestCompressedBodyIsCompressed(t *testing.T) {
+	entry := CacheEntry{Stdout: bytes.Repeat([]byte("a"), 10000), Compression: CompressionGzip}
+	data, err := encodeCacheEntry(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) >= len(entry.Stdout) {
+		t.Errorf("gzip entry takes %d bytes for %d bytes of output", len(data), len(entry.Stdout))
+	}
+	// The header stays readable without decompressing
+	header, _, _ := strings.Cut(string(data), "\n")
+	if !strings.Contains(header, `"compression":"gzip"`) {
+		t.Errorf("header %q does not record the compression", header)
+	}
+}
+
+func TestReadLegacyCacheFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "task.cache")
+	output := []byte("plain output from an older kasher\n")
+	if err := os.WriteFile(path, output, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readCacheFile(path)
+	if err != nil {
+		t.Fatalf("readCacheFile: %v", err)
+	}
+	assertEntry(t, got, CacheEntry{Stdout: output, Timestamp: modTime})
+}
+
+func TestReadInvalidCacheFile(t *testing.T) {
+	valid, err := encodeCacheEntry(CacheEntry{Stdout: []byte("out"), Stderr: []byte("err")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"no header line", cacheMagic + `{"exitCode":0}`},
+		{"header is not JSON", cacheMagic + "not json\nout"},
+		{"negative stdout size", cacheMagic + `{"stdoutSize":-1,"stderrSize":0}` + "\nout"},
+		{"negative stderr size", cacheMagic + `{"stdoutSize":0,"stderrSize":-5}` + "\nout"},
+		{"stdout size larger than the body", cacheMagic + `{"stdoutSize":1000000000000,"stderrSize":0}` + "\nout"},
+		{"sizes overflow", cacheMagic + `{"stdoutSize":9223372036854775807,"stderrSize":9223372036854775807}` + "\nout"},
+		{"truncated body", string(valid[:len(valid)-2])},
+		{"unknown compression", cacheMagic + `{"stdoutSize":3,"stderrSize":0,"compression":"lz4"}` + "\nout"},
+		{"corrupt gzip body", cacheMagic + `{"stdoutSize":3,"stderrSize":0,"compression":"gzip"}` + "\nout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "task.cache")
+			if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := readCacheFile(path)
+			if err == nil || !strings.Contains(err.Error(), "invalid cache file") {
+				t.Errorf("readCacheFile error = %v, want an invalid cache file error", err)
+			}
+		})
+	}
+}
+
+func TestSameOutput(t *testing.T) {
+	base := CacheEntry{Stdout: []byte("out"), Stderr: []byte("err"), Timestamp: time.Now(), Compression: CompressionGzip}
+	same := CacheEntry{Stdout: []byte("out"), Stderr: []byte("err"), Timestamp: time.Now().Add(time.Hour)}
+	if !base.SameOutput(same) {
+		t.Error("entries with the same output fetched at different times differ")
+	}
+	for name, other := range map[string]CacheEntry{
+		"stdout":    {Stdout: []byte("OUT"), Stderr: []byte("err")},
+		"stderr":    {Stdout: []byte("out"), Stderr: []byte("ERR")},
+		"exit code": {Stdout: []byte("out"), Stderr: []byte("err"), ExitCode: 1},
+	} {
+		if base.SameOutput(other) {
+			t.Errorf("entries with a different %s are the same", name)
+		}
+	}
+}
+
+// useTempCacheDir points the user cache directory at an empty temporary directory.
+func useTempCacheDir(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("LocalAppData", dir)
+}
+
+// writeTestCache writes a cache entry and one history entry for the key.
+func writeTestCache(t *testing.T, key, origin string) {
+	t.Helper()
+	entry := CacheEntry{Stdout: []byte(key), Timestamp: time.Now(), Origin: origin}
+	if err := WriteCache(key, entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := AppendHistory(key, entry, 5); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// cacheExists reports whether the key has a cache entry and a history.
+func cacheExists(t *testing.T, key string) (cached, history bool) {
+	t.Helper()
+	path, err := GetCacheFilePath(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+	entries, listErr := ListHistory(key)
+	if listErr != nil {
+		t.Fatal(listErr)
+	}
+	return err == nil, len(entries) > 0
+}
+
+func TestRemoveTaskCacheKeepsProjectTasks(t *testing.T) {
+	useTempCacheDir(t)
+	global := "foo"
+	variant := CacheKey("foo", "echo foo x")
+	project := TaskConfig{Command: "echo foo", Origin: "/src/project/.kasher.toml"}.CacheKeyFor("foo", "echo foo")
+	other := CacheKey("foobar", "x")
+	writeTestCache(t, global, "")
+	writeTestCache(t, variant, "")
+	writeTestCache(t, project, "/src/project/.kasher.toml")
+	writeTestCache(t, other, "")
+
+	if err := RemoveTaskCache("foo"); err != nil {
+		t.Fatalf("RemoveTaskCache: %v", err)
+	}
+	for _, key := range []string{global, variant} {
+		if cached, history := cacheExists(t, key); cached || history {
+			t.Errorf("entry %s of the global task: cached %v, history %v; want both removed", key, cached, history)
+		}
+	}
+	for _, key := range []string{project, other} {
+		if cached, history := cacheExists(t, key); !cached || !history {
+			t.Errorf("entry %s: cached %v, history %v; want both kept", key, cached, history)
+		}
+	}
+}
+
+func TestMoveTaskCacheKeepsProjectTasks(t *testing.T) {
+	useTempCacheDir(t)
+	variant := CacheKey("foo", "echo foo x")
+	origin := "/src/project/.kasher.toml"
+	project := TaskConfig{Command: "echo foo", Origin: origin}.CacheKeyFor("foo", "echo foo")
+	targetProject := TaskConfig{Command: "echo bar", Origin: origin}.CacheKeyFor("bar", "echo bar")
+	writeTestCache(t, variant, "")
+	writeTestCache(t, project, origin)
+	writeTestCache(t, targetProject, origin)
+
+	if err := MoveTaskCache("foo", "bar"); err != nil {
+		t.Fatalf("MoveTaskCache: %v", err)
+	}
+	moved := "bar" + variant[len("foo"):]
+	if cached, history := cacheExists(t, moved); !cached || !history {
+		t.Errorf("moved entry %s: cached %v, history %v; want both", moved, cached, history)
+	}
+	// Neither the project task of the old name nor that of the new name is touched
+	for _, key := range []string{project, targetProject} {
+		if cached, history := cacheExists(t, key); !cached || !history {
+			t.Errorf("project entry %s: cached %v, history %v; want both kept", key, cached, history)
+		}
+	}
+}
+
+// assertEntry compares the fields of a cache entry that are stored on disk.
+func assertEntry(t *testing.T, got, want CacheEntry) {
+	t.Helper()
+	if !bytes.Equal(got.Stdout, want.Stdout) {
+		t.Errorf("Stdout = %q, want %q", got.Stdout, want.Stdout)
+	}
+	if !bytes.Equal(got.Stderr, want.Stderr) {
+		t.Errorf("Stderr = %q, want %q", got.Stderr, want.Stderr)
+	}
+	if got.ExitCode != want.ExitCode {
+		t.Errorf("ExitCode = %d, want %d", got.ExitCode, want.ExitCode)
+	}
+	if got.Duration != want.Duration {
+		t.Errorf("Duration = %s, want %s", got.Duration, want.Duration)
+	}
+	if !got.Timestamp.Equal(want.Timestamp) {
+		t.Errorf("Timestamp = %s, want %s", got.Timestamp, want.Timestamp)
+	}
+	if got.WatchDigest != want.WatchDigest {
+		t.Errorf("WatchDigest = %q, want %q", got.WatchDigest, want.WatchDigest)
+	}
+	if got.Origin != want.Origin {
+		t.Errorf("Origin = %q, want %q", got.Origin, want.Origin)
+	}
+	if got.Compression != want.Compression {
+		t.Errorf("Compression = %q, want %q", got.Compression, want.Compression)
+	}
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Values for TaskConfig.Compression and Settings.Compression.
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// validateCompression checks a compression setting. An empty value is allowed and
+// means the default applies.
+func validateCompression(s string) error {
+	switch s {
+	case "", CompressionNone, CompressionGzip, CompressionZstd:
+		return nil
+	}
+	return fmt.Errorf("expected %q, %q or %q", CompressionNone, CompressionGzip, CompressionZstd)
+}
+
+// CacheCompression returns how the task's cache entries are compressed: the task's
+// own setting, or else the global one. An empty string means no compression.
+func (t TaskConfig) CacheCompression(settings Settings) string {
+	compression := t.Compression
+	if compression == "" {
+		compression = settings.Compression
+	}
+	if compression == CompressionNone {
+		return ""
+	}
+	return compression
+}
+
+// compress encodes data with the given method.
+func compress(data []byte, method string) ([]byte, error) {
+	var buf bytes.Buffer
+	var writer io.WriteCloser
+	switch method {
+	case CompressionGzip:
+		writer = gzip.NewWriter(&buf)
+	case CompressionZstd:
+		var err error
+		if writer, err = zstd.NewWriter(&buf); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown compression %q", method)
+	}
+	if _, err := writer.Write(data); err != nil {
+		writer.Close()
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress returns a reader of data decoded with the given method.
+func decompress(data io.Reader, method string) (io.ReadCloser, error) {
+	switch method {
+	case CompressionGzip:
+		return gzip.NewReader(data)
+	case CompressionZstd:
+		decoder, err := zstd.NewReader(data)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("unknown compression %q", method)
+}
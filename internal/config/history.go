@@ -0,0 +1,231 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HistoryEntry is one of the past outputs kept for a cache key.
+type HistoryEntry struct {
+	// Index numbers the entries from the most recent, which is 1.
+	Index     int
+	Path      string
+	Size      int64
+	Timestamp time.Time
+}
+
+// HistoryLength returns how many past outputs to keep for the task: its own history
+// setting, or else the global one. Zero means no history is kept.
+func (t TaskConfig) HistoryLength(settings Settings) int {
+	if t.History > 0 {
+		return t.History
+	}
+	return settings.History
+}
+
+// getHistoryRoot returns the directory holding the history of all cache keys.
+func getHistoryRoot() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "kasher", "history"), nil
+}
+
+// getHistoryDir returns the directory holding the history of a cache key.
+func getHistoryDir(key string) (string, error) {
+	root, err := getHistoryRoot()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, key), nil
+}
+
+// AppendHistory adds the entry to the history of the cache key, then removes the
+// oldest entries so that at most keep remain.
+func AppendHistory(key string, entry CacheEntry, keep int) error {
+	dir, err := getHistoryDir(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	data, err := encodeCacheEntry(entry)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%020d.cache", entry.Timestamp.UnixNano()))
+	if err := writeFileAtomic(path, data, 0o644); err != nil {
+		return err
+	}
+	entries, err := ListHistory(key)
+	if err != nil {
+		return err
+	}
+	for _, old := range entries[min(keep, len(entries)):] {
+		if err := os.Remove(old.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListHistory returns the past outputs kept for the cache key, most recent first.
+func ListHistory(key string) ([]HistoryEntry, error) {
+	dir, err := getHistoryDir(key)
+	if err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var entries []HistoryEntry
+	for _, file := range files {
+		name, ok := strings.CutSuffix(file.Name(), ".cache")
+		if !ok || file.IsDir() {
+			continue
+		}
+		nanos, err := strconv.ParseInt(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, HistoryEntry{
+			Path:      filepath.Join(dir, file.Name()),
+			Size:      info.Size(),
+			Timestamp: time.Unix(0, nanos),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Timestamp.After(entries[j].Timestamp) })
+	for i := range entries {
+		entries[i].Index = i + 1
+	}
+	return entries, nil
+}
+
+// ReadHistory reads a past output of the cache key by its index (see HistoryEntry).
+func ReadHistory(key string, index int) (CacheEntry, error) {
+	entries, err := ListHistory(key)
+	if err != nil {
+		return CacheEntry{}, err
+	}
+	if index < 1 || index > len(entries) {
+		return CacheEntry{}, fmt.Errorf("no history entry %d (there are %d)", index, len(entries))
+	}
+	return readCacheFile(entries[index-1].Path)
+}
+
+// HistorySize returns the total size of the past outputs kept for the cache key.
+func HistorySize(key string) int64 {
+	entries, err := ListHistory(key)
+	if err != nil {
+		return 0
+	}
+	var size int64
+	for _, entry := range entries {
+		size += entry.Size
+	}
+	return size
+}
+
+// OrphanedHistoryKeys returns the keys that have a history but no cache entry, left
+// behind by cache entries removed without their history.
+func OrphanedHistoryKeys() ([]string, error) {
+	root, err := getHistoryRoot()
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := os.ReadDir(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		path, err := GetCacheFilePath(dir.Name())
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			keys = append(keys, dir.Name())
+		}
+	}
+	return keys, nil
+}
+
+// RemoveHistory deletes the history of the cache key.
+func RemoveHistory(key string) error {
+	dir, err := getHistoryDir(key)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// taskHistoryKeys returns the cache keys of the named global task that have a history,
+// leaving out those of project tasks with the same name.
+func taskHistoryKeys(taskName string) ([]string, error) {
+	root, err := getHistoryRoot()
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := os.ReadDir(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, dir := range dirs {
+		key := dir.Name()
+		if dir.IsDir() && isGlobalTaskKeyOf(key, taskName) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// transferTaskHistory moves or copies the history of a global task to another task name.
+func transferTaskHistory(from, to string, move bool) error {
+	keys, err := taskHistoryKeys(from)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		oldDir, err := getHistoryDir(key)
+		if err != nil {
+			return err
+		}
+		newDir, err := getHistoryDir(to + strings.TrimPrefix(key, from))
+		if err != nil {
+			return err
+		}
+		if move {
+			if err := os.Rename(oldDir, newDir); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.CopyFS(newDir, os.DirFS(oldDir)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
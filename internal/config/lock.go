@@ -0,0 +1,77 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Lock is an exclusive lock on a file, shared between kasher processes.
+type Lock struct {
+	file *os.File
+}
+
+// LockTask blocks until it holds the lock for the given cache key.
+// It keeps concurrent kasher processes from running the same command at once.
+func LockTask(key string) (*Lock, error) {
+	path, err := taskLockPath(key)
+	if err != nil {
+		return nil, err
+	}
+	return acquireLock(path, true)
+}
+
+// TryLockTask takes the lock for the given cache key if no other process holds it.
+// It returns a nil Lock when the lock is busy.
+func TryLockTask(key string) (*Lock, error) {
+	path, err := taskLockPath(key)
+	if err != nil {
+		return nil, err
+	}
+	return acquireLock(path, false)
+}
+
+// LockConfig blocks until it holds the lock guarding changes to the config file.
+func LockConfig() (*Lock, error) {
+	path, err := getConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	return acquireLock(path+".lock", true)
+}
+
+// Unlock releases the lock.
+func (l *Lock) Unlock() error {
+	if err := unlockFile(l.file); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
+
+// taskLockPath returns the path of the lock file for the given cache key.
+func taskLockPath(key string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	lockDir := filepath.Join(dir, "kasher", "locks")
+	if err := os.MkdirAll(lockDir, 0o755); err != nil {
+		return "", err
+	}
+	return filepath.Join(lockDir, key+".lock"), nil
+}
+
+// acquireLock opens the lock file and locks it. When wait is false and another
+// process holds the lock, it returns nil without an error.
+func acquireLock(path string, wait bool) (*Lock, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	locked, err := lockFile(file, wait)
+	if err != nil || !locked {
+		file.Close()
+		return nil, err
+	}
+	return &Lock{file: file}, nil
+}
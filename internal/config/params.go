@@ -0,0 +1,121 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+)
+
+// placeholderPattern matches command placeholders such as {{.Args}}, {{.1}} or {{.namespace}}.
+var placeholderPattern = regexp.MustCompile(`\{\{\s*\.([A-Za-z_][A-Za-z0-9_]*|[0-9]+)\s*\}\}`)
+
+// namedArgPattern matches a named parameter passed on the command line as key=value.
+var namedArgPattern = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)=(.*)$`)
+
+// IsParameterized reports whether the task command contains any placeholders.
+func (t TaskConfig) IsParameterized() bool {
+	return placeholderPattern.MatchString(t.Command)
+}
+
+// RenderCommand fills the placeholders in the task command from the given arguments.
+// Arguments of the form key=value set the named parameter key when the command
+// references it; all other arguments are positional. {{.Args}} expands to every
+// positional argument, {{.N}} to the Nth one (starting at 1) and {{.name}} to a named
+// parameter, falling back to its default from Params. Substituted values are shell-quoted.
+func (t TaskConfig) RenderCommand(args []string) (string, error) {
+	if !t.IsParameterized() {
+		if len(args) > 0 {
+			return "", fmt.Errorf("command takes no arguments (add placeholders such as {{.Args}} to accept them)")
+		}
+		return t.Command, nil
+	}
+
+	referenced := make(map[string]bool)
+	for _, match := range placeholderPattern.FindAllStringSubmatch(t.Command, -1) {
+		referenced[match[1]] = true
+	}
+
+	named := make(map[string]string)
+	var positional []string
+	for _, arg := range args {
+		if m := namedArgPattern.FindStringSubmatch(arg); m != nil && m[1] != "Args" && referenced[m[1]] {
+			named[m[1]] = m[2]
+			continue
+		}
+		positional = append(positional, arg)
+	}
+
+	var renderErr error
+	rendered := placeholderPattern.ReplaceAllStringFunc(t.Command, func(placeholder string) string {
+		name := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		if name == "Args" {
+			return shellquote.Join(positional...)
+		}
+		if n, err := strconv.Atoi(name); err == nil {
+			if n < 1 || n > len(positional) {
+				if renderErr == nil {
+					renderErr = fmt.Errorf("missing positional argument %d", n)
+				}
+				return ""
+			}
+			return shellquote.Join(positional[n-1])
+		}
+		value, ok := named[name]
+		if !ok {
+			value, ok = t.Params[name]
+		}
+		if !ok {
+			if renderErr == nil {
+				renderErr = fmt.Errorf("missing value for parameter '%s' (pass it as %s=<value>)", name, name)
+			}
+			return ""
+		}
+		return shellquote.Join(value)
+	})
+	if renderErr != nil {
+		return "", renderErr
+	}
+	return rendered, nil
+}
+
+// CacheKeyFor returns the cache key for a run of the task with the given rendered
+// command. Project tasks, parameterized tasks and tasks whose cache depends on the
+// environment get a hashed key (see CacheKey), so each project, argument combination,
+// CacheKeyEnv variable value and (with CacheKeyCwd) working directory has its own entry.
+func (t TaskConfig) CacheKeyFor(taskName, command string) string {
+	var parts []string
+	if t.IsProjectTask() {
+		parts = append(parts, t.Origin)
+	}
+	if t.IsParameterized() {
+		parts = append(parts, command)
+	}
+	for _, name := range t.CacheKeyEnv {
+		parts = append(parts, "env:"+name+"="+os.Getenv(name))
+	}
+	if t.CacheKeyCwd {
+		cwd, _ := os.Getwd()
+		parts = append(parts, "cwd:"+cwd)
+	}
+	return CacheKey(taskName, parts...)
+}
+
+// cacheKeyHashLength is the number of hex digits of the hash suffix of cache keys.
+const cacheKeyHashLength = 16
+
+// CacheKey returns the key used to name the cache file of a task.
+// Plain tasks are keyed on their name alone. When parts are given (such as a rendered
+// command) a short hash of them is appended, so each variant keeps its own cache entry.
+func CacheKey(taskName string, parts ...string) string {
+	if len(parts) == 0 {
+		return taskName
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return taskName + "." + hex.EncodeToString(sum[:])[:cacheKeyHashLength]
+}
@@ -0,0 +1,195 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		params  map[string]string
+		args    []string
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "no placeholders",
+			command: "kubectl get pods",
+			want:    "kubectl get pods",
+		},
+		{
+			name:    "no placeholders with arguments",
+			command: "kubectl get pods",
+			args:    []string{"extra"},
+			wantErr: "command takes no arguments",
+		},
+		{
+			name:    "all arguments",
+			command: "ls {{.Args}}",
+			args:    []string{"-l", "/tmp"},
+			want:    "ls -l /tmp",
+		},
+		{
+			name:    "all arguments when there are none",
+			command: "ls {{.Args}}",
+			want:    "ls ",
+		},
+		{
+			name:    "positional arguments",
+			command: "echo {{.2}} {{.1}}",
+			args:    []string{"first", "second"},
+			want:    "echo second first",
+		},
+		{
+			name:    "spaces around the name",
+			command: "echo {{ .1 }}",
+			args:    []string{"x"},
+			want:    "echo x",
+		},
+		{
+			name:    "missing positional argument",
+			command: "echo {{.1}} {{.2}}",
+			args:    []string{"first"},
+			wantErr: "missing positional argument 2",
+		},
+		{
+			name:    "values are shell-quoted",
+			command: "echo {{.1}} {{.Args}}",
+			args:    []string{"a b", "$(rm -rf ~)"},
+			want:    `echo 'a b' 'a b' '$(rm -rf ~)'`,
+		},
+		{
+			name:    "named parameter",
+			command: "kubectl get pods -n {{.namespace}}",
+			args:    []string{"namespace=prod"},
+			want:    "kubectl get pods -n prod",
+		},
+		{
+			name:    "named parameter default",
+			command: "kubectl get pods -n {{.namespace}}",
+			params:  map[string]string{"namespace": "default"},
+			want:    "kubectl get pods -n default",
+		},
+		{
+			name:    "named parameter overrides its default",
+			command: "kubectl get pods -n {{.namespace}}",
+			params:  map[string]string{"namespace": "default"},
+			args:    []string{"namespace=prod"},
+			want:    "kubectl get pods -n prod",
+		},
+		{
+			name:    "named parameter value is shell-quoted",
+			command: "grep {{.pattern}} log",
+			args:    []string{"pattern=a b;c"},
+			want:    "grep 'a b;c' log",
+		},
+		{
+			name:    "missing named parameter",
+			command: "kubectl get pods -n {{.namespace}}",
+			wantErr: "missing value for parameter 'namespace'",
+		},
+		{
+			name:    "key=value for an unreferenced name is positional",
+			command: "echo {{.Args}}",
+			args:    []string{"a=b"},
+			want:    "echo a=b",
+		},
+		{
+			name:    "named and positional arguments mixed",
+			command: "kubectl logs -n {{.namespace}} {{.1}}",
+			args:    []string{"web-1", "namespace=prod"},
+			want:    "kubectl logs -n prod web-1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := TaskConfig{Command: tt.command, Params: tt.params}
+			got, err := task.RenderCommand(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("RenderCommand(%q) error = %v, want it to contain %q", tt.args, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RenderCommand(%q) error = %v", tt.args, err)
+			}
+			if got != tt.want {
+				t.Errorf("RenderCommand(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	if got := CacheKey("pods"); got != "pods" {
+		t.Errorf("CacheKey without parts = %q, want %q", got, "pods")
+	}
+
+	key := CacheKey("pods", "kubectl get pods -n prod")
+	if !isHashedKeyOf(key, "pods") {
+		t.Errorf("CacheKey with parts = %q, want the name followed by a %d digit hash", key, cacheKeyHashLength)
+	}
+	if again := CacheKey("pods", "kubectl get pods -n prod"); again != key {
+		t.Errorf("CacheKey is not stable: %q, then %q", key, again)
+	}
+	if other := CacheKey("pods", "kubectl get pods -n dev"); other == key {
+		t.Errorf("CacheKey gives different commands the same key %q", key)
+	}
+	// Parts are separated, so moving text between them changes the key
+	if CacheKey("pods", "ab", "c") == CacheKey("pods", "a", "bc") {
+		t.Error("CacheKey does not separate its parts")
+	}
+}
+
+func TestIsHashedKeyOf(t *testing.T) {
+	tests := []struct {
+		key, taskName string
+		want          bool
+	}{
+		{CacheKey("pods", "x"), "pods", true},
+		{"pods", "pods", false},
+		{"pods.0123456789abcdef", "pods", true},
+		{"pods.0123456789ABCDEG", "pods", false},
+		{"pods.0123456789abcde", "pods", false},
+		{"pods.backup.0123456789abcdef", "pods", false},
+		{"pods.backup.0123456789abcdef", "pods.backup", true},
+		{"podsx.0123456789abcdef", "pods", false},
+	}
+	for _, tt := range tests {
+		if got := isHashedKeyOf(tt.key, tt.taskName); got != tt.want {
+			t.Errorf("isHashedKeyOf(%q, %q) = %v, want %v", tt.key, tt.taskName, got, tt.want)
+		}
+	}
+}
+
+func TestCacheKeyFor(t *testing.T) {
+	plain := TaskConfig{Command: "date"}
+	if got := plain.CacheKeyFor("now", "date"); got != "now" {
+		t.Errorf("plain task key = %q, want %q", got, "now")
+	}
+
+	param := TaskConfig{Command: "echo {{.Args}}"}
+	if param.CacheKeyFor("echo", "echo a") == param.CacheKeyFor("echo", "echo b") {
+		t.Error("parameterized task renders with different arguments share a key")
+	}
+
+	project := TaskConfig{Command: "date", Origin: "/src/a/.kasher.toml"}
+	other := TaskConfig{Command: "date", Origin: "/src/b/.kasher.toml"}
+	if project.CacheKeyFor("now", "date") == other.CacheKeyFor("now", "date") {
+		t.Error("tasks of different projects share a key")
+	}
+	if project.CacheKeyFor("now", "date") == "now" {
+		t.Error("project task shares its key with the global task")
+	}
+
+	env := TaskConfig{Command: "kubectl get pods", CacheKeyEnv: []string{"KUBECONFIG"}}
+	t.Setenv("KUBECONFIG", "/a")
+	keyA := env.CacheKeyFor("pods", env.Command)
+	t.Setenv("KUBECONFIG", "/b")
+	if keyB := env.CacheKeyFor("pods", env.Command); keyA == keyB {
+		t.Error("cacheKeyEnv task with different variable values share a key")
+	}
+}
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Values for TaskConfig.CacheOn. Besides these, CacheOn may list exit codes, e.g. "0,1".
+const (
+	CacheOnSuccess = "success"
+	CacheOnAlways  = "always"
+)
+
+// Validate checks that the task's settings can be used to run it.
+func (t TaskConfig) Validate() error {
+	if strings.TrimSpace(t.Command) == "" {
+		return errors.New("command is required")
+	}
+	if t.Expiration != "" {
+		if _, err := ParseExpiration(t.Expiration); err != nil {
+			return fmt.Errorf("invalid expiration %q: %w", t.Expiration, err)
+		}
+	}
+	if _, err := parseOptionalDuration(t.StaleWhileRevalidate); err != nil {
+		return fmt.Errorf("invalid staleWhileRevalidate %q: %w", t.StaleWhileRevalidate, err)
+	}
+	if _, err := parseOptionalDuration(t.StaleIfError); err != nil {
+		return fmt.Errorf("invalid staleIfError %q: %w", t.StaleIfError, err)
+	}
+	if _, err := parseOptionalDuration(t.Timeout); err != nil {
+		return fmt.Errorf("invalid timeout %q: %w", t.Timeout, err)
+	}
+	if t.Retries < 0 {
+		return fmt.Errorf("invalid retries %d: must not be negative", t.Retries)
+	}
+	if _, err := parseOptionalDuration(t.RetryBackoff); err != nil {
+		return fmt.Errorf("invalid retryBackoff %q: %w", t.RetryBackoff, err)
+	}
+	for _, name := range t.CacheKeyEnv {
+		if name == "" || strings.ContainsAny(name, "= ") {
+			return fmt.Errorf("invalid cacheKeyEnv variable name %q", name)
+		}
+	}
+	for _, pattern := range t.WatchFiles {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid watchFiles pattern %q: %w", pattern, err)
+		}
+	}
+	if t.MaxCacheSize != "" {
+		if _, err := ParseSize(t.MaxCacheSize); err != nil {
+			return fmt.Errorf("invalid maxCacheSize: %w", err)
+		}
+	}
+	if err := validateCompression(t.Compression); err != nil {
+		return fmt.Errorf("invalid compression %q: %w", t.Compression, err)
+	}
+	if t.History < 0 {
+		return fmt.Errorf("invalid history %d: must not be negative", t.History)
+	}
+	switch strings.TrimSpace(t.CacheOn) {
+	case "", CacheOnSuccess, CacheOnAlways:
+	default:
+		if _, err := parseExitCodes(t.CacheOn); err != nil {
+			return fmt.Errorf("invalid cacheOn %q: expected %q, %q or a list of exit codes", t.CacheOn, CacheOnSuccess, CacheOnAlways)
+		}
+	}
+	return nil
+}
+
+// ShouldCache reports whether a run that exited with the given code may be cached
+// under the task's CacheOn policy. "success" (the default) caches only exit code 0,
+// "always" caches every run, and a comma-separated list caches just those exit codes.
+func (t TaskConfig) ShouldCache(exitCode int) bool {
+	switch strings.TrimSpace(t.CacheOn) {
+	case "", CacheOnSuccess:
+		return exitCode == 0
+	case CacheOnAlways:
+		return true
+	}
+	codes, err := parseExitCodes(t.CacheOn)
+	if err != nil {
+		return exitCode == 0
+	}
+	for _, code := range codes {
+		if code == exitCode {
+			return true
+		}
+	}
+	return false
+}
+
+// StaleWhileRevalidateWindow returns how long past expiration the cache may be served
+// while it is refreshed in the background. It is zero when the setting is unset or invalid.
+func (t TaskConfig) StaleWhileRevalidateWindow() time.Duration {
+	d, _ := parseOptionalDuration(t.StaleWhileRevalidate)
+	return d
+}
+
+// StaleIfErrorWindow returns how long past expiration the cache may be served when a
+// refresh fails. It is zero when the setting is unset or invalid.
+func (t TaskConfig) StaleIfErrorWindow() time.Duration {
+	d, _ := parseOptionalDuration(t.StaleIfError)
+	return d
+}
+
+// TimeoutDuration returns how long the task's command may run before it is killed.
+// It is zero, meaning no limit, when the setting is unset or invalid.
+func (t TaskConfig) TimeoutDuration() time.Duration {
+	d, _ := parseOptionalDuration(t.Timeout)
+	return d
+}
+
+// MaxCacheSizeBytes returns the largest output, in bytes, the task may cache.
+// It is zero, meaning no limit, when the setting is unset or invalid.
+func (t TaskConfig) MaxCacheSizeBytes() int64 {
+	if t.MaxCacheSize == "" {
+		return 0
+	}
+	size, _ := ParseSize(t.MaxCacheSize)
+	return size
+}
+
+// defaultRetryBackoff is the delay before the first retry when RetryBackoff is unset.
+const defaultRetryBackoff = time.Second
+
+// RetryBackoffDuration returns the delay before the first retry. The delay doubles
+// after every further attempt.
+func (t TaskConfig) RetryBackoffDuration() time.Duration {
+	d, err := parseOptionalDuration(t.RetryBackoff)
+	if err != nil || t.RetryBackoff == "" {
+		return defaultRetryBackoff
+	}
+	return d
+}
+
+// ShouldRetry reports whether a run that exited with the given code should be retried.
+// Without RetryOnExitCodes every result the cache policy rejects is retried.
+func (t TaskConfig) ShouldRetry(exitCode int) bool {
+	if len(t.RetryOnExitCodes) == 0 {
+		return !t.ShouldCache(exitCode)
+	}
+	for _, code := range t.RetryOnExitCodes {
+		if code == exitCode {
+			return true
+		}
+	}
+	return false
+}
+
+// parseOptionalDuration parses a duration setting, treating an empty string as zero.
+func parseOptionalDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// parseExitCodes parses a comma-separated list of exit codes such as "0,1,2".
+func parseExitCodes(s string) ([]int, error) {
+	var codes []int
+	for _, field := range strings.Split(s, ",") {
+		code, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
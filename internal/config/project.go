@@ -0,0 +1,81 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// ProjectConfigName is the name of the project task file kasher looks for in the
+// working directory and its parents.
+const ProjectConfigName = ".kasher.toml"
+
+// FindProjectConfig returns the path of the nearest project task file, searching the
+// working directory and then each parent directory in turn, like git does for .git.
+// It returns an empty path if there is none.
+func FindProjectConfig() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, ProjectConfigName)
+		info, err := os.Stat(path)
+		if err == nil && !info.IsDir() {
+			return path, nil
+		} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// loadProjectConfig reads the tasks of a project task file and records the file as
+// their origin.
+func loadProjectConfig(path string) (KasherConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg KasherConfig
+	if err := toml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid project task file %s: %w", path, err)
+	}
+	for name, task := range cfg {
+		task.Origin = path
+		cfg[name] = task
+	}
+	return cfg, nil
+}
+
+// IsProjectTask reports whether the task was loaded from a project task file.
+func (t TaskConfig) IsProjectTask() bool {
+	return t.Origin != ""
+}
+
+// WorkDir returns the directory the task's command runs in. Project tasks run from
+// the directory of their task file; global tasks run from the current directory,
+// reported as an empty string.
+func (t TaskConfig) WorkDir() string {
+	if !t.IsProjectTask() {
+		return ""
+	}
+	return filepath.Dir(t.Origin)
+}
+
+// StateKey returns the key under which the task's runtime state is recorded.
+// Project tasks are keyed on their task file as well, so they don't share state with
+// global tasks or tasks of other projects that have the same name.
+func (t TaskConfig) StateKey(taskName string) string {
+	if !t.IsProjectTask() {
+		return taskName
+	}
+	return taskName + "@" + t.Origin
+}
@@ -0,0 +1,235 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CacheFile describes an entry in the cache directory without loading its output.
+type CacheFile struct {
+	Key       string
+	Path      string
+	Size      int64
+	Timestamp time.Time
+	// LastUsed is when the entry was last written or served (see TouchCache).
+	LastUsed time.Time
+	// Origin is the project task file of the task the entry belongs to (see CacheEntry.Origin).
+	Origin string
+	// HistorySize is the total size of the past outputs kept for the entry (see AppendHistory).
+	HistorySize int64
+}
+
+// TaskName returns the name of the task the entry was cached for, leaving out the
+// hash suffix of argument and environment variants (see CacheKey).
+func (f CacheFile) TaskName() string {
+	name, suffix, found := cutLast(f.Key, ".")
+	if !found || len(suffix) != cacheKeyHashLength {
+		return f.Key
+	}
+	if _, err := hex.DecodeString(suffix); err != nil {
+		return f.Key
+	}
+	return name
+}
+
+// cutLast slices s around the last instance of sep.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// ListCacheFiles returns every entry in the cache directory.
+func ListCacheFiles() ([]CacheFile, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	cacheDir := filepath.Join(dir, "kasher")
+	entries, err := os.ReadDir(cacheDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var files []CacheFile
+	for _, entry := range entries {
+		key, ok := strings.CutSuffix(entry.Name(), ".cache")
+		if !ok || entry.IsDir() || strings.HasPrefix(key, ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // removed since the directory was read
+		}
+		file := CacheFile{
+			Key:       key,
+			Path:      filepath.Join(cacheDir, entry.Name()),
+			Size:      info.Size(),
+			Timestamp: info.ModTime(),
+			LastUsed:  info.ModTime(),
+		}
+		if header, err := readCacheHeader(file.Path); err == nil {
+			file.Timestamp = header.Timestamp
+			file.Origin = header.Origin
+		}
+		file.HistorySize = HistorySize(key)
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// readCacheHeader reads just the metadata line of a structured cache file.
+func readCacheHeader(path string) (cacheHeader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return cacheHeader{}, err
+	}
+	defer file.Close()
+	line, err := bufio.NewReader(file).ReadBytes('\n')
+	if err != nil {
+		return cacheHeader{}, err
+	}
+	rest, ok := bytes.CutPrefix(line, []byte(cacheMagic))
+	if !ok {
+		return cacheHeader{}, errors.New("not a structured cache file")
+	}
+	var header cacheHeader
+	err = json.Unmarshal(rest, &header)
+	return header, err
+}
+
+// TouchCache records that the cache entry for key was just served, so it is evicted
+// last (see EvictCache). The time is kept as the file's modification time. Plain-text
+// caches of older versions are left alone, as their modification time is their fetch time.
+func TouchCache(key string) error {
+	path, err := GetCacheFilePath(key)
+	if err != nil {
+		return err
+	}
+	if _, err := readCacheHeader(path); err != nil {
+		return nil
+	}
+	now := time.Now()
+	return os.Chtimes(path, now, now)
+}
+
+// EvictCache removes the least recently used cache entries, along with their history,
+// until all entries and their history together take up at most budget bytes. The entry
+// for key keep is never evicted, nor are entries a kasher process is refreshing. It
+// returns the evicted entries.
+func EvictCache(budget int64, keep string) ([]CacheFile, error) {
+	files, err := ListCacheFiles()
+	if err != nil {
+		return nil, err
+	}
+	var total int64
+	for _, file := range files {
+		total += file.Size + file.HistorySize
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].LastUsed.Before(files[j].LastUsed) })
+	var evicted []CacheFile
+	for _, file := range files {
+		if total <= budget {
+			break
+		}
+		if file.Key == keep {
+			continue
+		}
+		lock, err := TryLockTask(file.Key)
+		if err != nil || lock == nil {
+			continue
+		}
+		err = os.Remove(file.Path)
+		if err == nil {
+			err = RemoveHistory(file.Key)
+		}
+		lock.Unlock()
+		if err != nil {
+			continue
+		}
+		total -= file.Size + file.HistorySize
+		evicted = append(evicted, file)
+	}
+	return evicted, nil
+}
+
+// CacheOwners finds the tasks cache entries belong to. Entries of project tasks are
+// checked against their own project task file, wherever it is.
+type CacheOwners struct {
+	global   KasherConfig
+	current  KasherConfig
+	projects map[string]KasherConfig
+}
+
+// NewCacheOwners loads the task definitions needed to find the owners of cache entries.
+func NewCacheOwners() (*CacheOwners, error) {
+	global, err := loadGlobalConfig()
+	if err != nil {
+		return nil, err
+	}
+	current, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &CacheOwners{global: global, current: current, projects: make(map[string]KasherConfig)}, nil
+}
+
+// Owner returns the task the cache entry was written for. It reports false when the
+// task no longer exists, making the entry an orphan.
+func (o *CacheOwners) Owner(file CacheFile) (TaskConfig, bool) {
+	name := file.TaskName()
+	if file.Origin == "" {
+		// Entries written before origins were recorded may also belong to a task
+		// of the current project
+		if task, ok := o.global[name]; ok {
+			return task, true
+		}
+		task, ok := o.current[name]
+		return task, ok
+	}
+	project, loaded := o.projects[file.Origin]
+	if !loaded {
+		// A missing or broken project task file owns no tasks
+		project, _ = loadProjectConfig(file.Origin)
+		o.projects[file.Origin] = project
+	}
+	task, ok := project[name]
+	return task, ok
+}
+
+// ParseSize parses a size in bytes with an optional unit, e.g. "512K", "10MB" or
+// "1GiB". Units are powers of 1024.
+func ParseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "B"), "I")
+	multiplier := int64(1)
+	if value != "" {
+		if i := strings.IndexByte("KMGT", value[len(value)-1]); i >= 0 {
+			multiplier = int64(1) << (10 * (i + 1))
+			value = value[:len(value)-1]
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || n < 0 || math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("invalid size %q: expected a number of bytes with an optional unit, e.g. 512K, 10MB or 1GB", s)
+	}
+	size := n * float64(multiplier)
+	// float64(math.MaxInt64) rounds up to 2^63, which no longer fits in an int64
+	if size >= float64(math.MaxInt64) {
+		return 0, fmt.Errorf("invalid size %q: too large", s)
+	}
+	return int64(size), nil
+}
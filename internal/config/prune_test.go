@@ -0,0 +1,48 @@
+package config
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "0", want: 0},
+		{in: "512", want: 512},
+		{in: "512B", want: 512},
+		{in: "512K", want: 512 << 10},
+		{in: "512k", want: 512 << 10},
+		{in: "10MB", want: 10 << 20},
+		{in: "10 MB", want: 10 << 20},
+		{in: "1GiB", want: 1 << 30},
+		{in: "1.5G", want: 3 << 29},
+		{in: "2T", want: 2 << 40},
+		{in: " 1g ", want: 1 << 30},
+		{in: "", wantErr: true},
+		{in: "MB", wantErr: true},
+		{in: "-1", wantErr: true},
+		{in: "ten", wantErr: true},
+		{in: "10XB", wantErr: true},
+		{in: "NaN", wantErr: true},
+		{in: "Inf", wantErr: true},
+		{in: "-Inf", wantErr: true},
+		{in: "1e30", wantErr: true},
+		{in: "9223372036854775807", wantErr: true},
+		{in: "8388608T", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseSize(%q) = %d, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSize(%q) error = %v", tt.in, err)
+		} else if got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
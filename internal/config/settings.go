@@ -0,0 +1,75 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Settings are kasher-wide options that apply to all tasks. They live in their own
+// file next to the config file, which only holds task definitions.
+type Settings struct {
+	// CacheBudget caps the total size of the cache directory, e.g. "500MB". When a new
+	// entry takes it over the budget, the least recently used entries are evicted.
+	CacheBudget string `toml:"cacheBudget,omitempty"`
+	// Compression is how cache entries are compressed unless a task says otherwise:
+	// "gzip", "zstd" or "none" (the default).
+	Compression string `toml:"compression,omitempty"`
+	// History is how many past outputs to keep per cache entry unless a task says
+	// otherwise (see AppendHistory). The default of zero keeps none.
+	History int `toml:"history,omitempty"`
+}
+
+// getSettingsPath returns the path to the kasher settings file.
+func getSettingsPath() (string, error) {
+	path, err := getConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "settings.toml"), nil
+}
+
+// GetSettingsPath returns the path to the kasher settings file.
+func GetSettingsPath() (string, error) {
+	return getSettingsPath()
+}
+
+// LoadSettings loads the kasher settings file and checks its values.
+// If the file does not exist, it returns the default settings.
+func LoadSettings() (Settings, error) {
+	path, err := getSettingsPath()
+	if err != nil {
+		return Settings{}, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Settings{}, nil
+	} else if err != nil {
+		return Settings{}, err
+	}
+	var settings Settings
+	if err := toml.Unmarshal(data, &settings); err != nil {
+		return Settings{}, fmt.Errorf("invalid settings file %s: %w", path, err)
+	}
+	if _, err := settings.CacheBudgetBytes(); err != nil {
+		return Settings{}, fmt.Errorf("invalid settings file %s: cacheBudget: %w", path, err)
+	}
+	if err := validateCompression(settings.Compression); err != nil {
+		return Settings{}, fmt.Errorf("invalid settings file %s: compression %q: %w", path, settings.Compression, err)
+	}
+	if settings.History < 0 {
+		return Settings{}, fmt.Errorf("invalid settings file %s: history must not be negative", path)
+	}
+	return settings, nil
+}
+
+// CacheBudgetBytes returns the cache budget in bytes, or zero for no limit.
+func (s Settings) CacheBudgetBytes() (int64, error) {
+	if s.CacheBudget == "" {
+		return 0, nil
+	}
+	return ParseSize(s.CacheBudget)
+}
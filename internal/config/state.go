@@ -0,0 +1,131 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// TaskState is the runtime state kasher records for a task. It is kept apart from
+// the task definitions so running tasks never rewrites the config file.
+type TaskState struct {
+	LastFetched  time.Time `json:"lastFetched,omitzero"`
+	LastDuration string    `json:"lastDuration,omitempty"`
+	LastExitCode int       `json:"lastExitCode"`
+	Hits         int       `json:"hits"`
+	Runs         int       `json:"runs"`
+}
+
+// State maps task names to their runtime state.
+type State map[string]TaskState
+
+// getStatePath returns the path to the kasher state file in the cache directory.
+func getStatePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	kasherDir := filepath.Join(dir, "kasher")
+	if err := os.MkdirAll(kasherDir, 0o755); err != nil {
+		return "", err
+	}
+	return filepath.Join(kasherDir, "state.json"), nil
+}
+
+// LoadState loads the runtime state of all tasks.
+// If the state file does not exist, it returns an empty State.
+func LoadState() (State, error) {
+	path, err := getStatePath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return make(State), nil
+	} else if err != nil {
+		return nil, err
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	if state == nil {
+		state = make(State)
+	}
+	return state, nil
+}
+
+// UpdateState loads the state, applies fn to it and saves the result while holding
+// the state lock. Nothing is saved if fn returns an error.
+func UpdateState(fn func(state State) error) error {
+	path, err := getStatePath()
+	if err != nil {
+		return err
+	}
+	lock, err := acquireLock(path+".lock", true)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	state, err := LoadState()
+	if err != nil {
+		return err
+	}
+	if err := fn(state); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0o644)
+}
+
+// UpdateTaskState applies fn to the state of a single task and saves it.
+func UpdateTaskState(taskName string, fn func(task *TaskState)) error {
+	return UpdateState(func(state State) error {
+		task := state[taskName]
+		fn(&task)
+		state[taskName] = task
+		return nil
+	})
+}
+
+// migrateLastFetched moves lastFetched values that older versions of kasher stored
+// in the config file into the state file. It reports whether any were found, in
+// which case the config file should be rewritten without them.
+func migrateLastFetched(data []byte) (bool, error) {
+	var legacy map[string]struct {
+		LastFetched string `toml:"lastFetched"`
+	}
+	if err := toml.Unmarshal(data, &legacy); err != nil {
+		return false, err
+	}
+	found := make(map[string]time.Time)
+	for name, task := range legacy {
+		if task.LastFetched == "" {
+			continue
+		}
+		// An unparsable value migrates as never fetched
+		fetched, _ := time.Parse(time.RFC3339, task.LastFetched)
+		found[name] = fetched
+	}
+	if len(found) == 0 {
+		return false, nil
+	}
+	err := UpdateState(func(state State) error {
+		for name, fetched := range found {
+			task := state[name]
+			if task.LastFetched.IsZero() {
+				task.LastFetched = fetched
+				state[name] = task
+			}
+		}
+		return nil
+	})
+	return err == nil, err
+}
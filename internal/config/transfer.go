@@ -0,0 +1,76 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats task definitions can be imported from and exported to.
+const (
+	FormatTOML = "toml"
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+)
+
+// FormatFromPath guesses the task file format from a file extension.
+// It returns an empty string if the extension is not recognised.
+func FormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		return FormatTOML
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".json":
+		return FormatJSON
+	}
+	return ""
+}
+
+// MarshalTasks encodes task definitions in the given format.
+func MarshalTasks(cfg KasherConfig, format string) ([]byte, error) {
+	switch format {
+	case FormatTOML:
+		return toml.Marshal(cfg)
+	case FormatYAML:
+		return yaml.Marshal(cfg)
+	case FormatJSON:
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false) // commands are full of & and >
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(cfg); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unsupported format %q (expected %s, %s or %s)", format, FormatTOML, FormatYAML, FormatJSON)
+}
+
+// UnmarshalTasks decodes task definitions in the given format.
+func UnmarshalTasks(data []byte, format string) (KasherConfig, error) {
+	var cfg KasherConfig
+	var err error
+	switch format {
+	case FormatTOML:
+		err = toml.Unmarshal(data, &cfg)
+	case FormatYAML:
+		err = yaml.Unmarshal(data, &cfg)
+	case FormatJSON:
+		err = json.Unmarshal(data, &cfg)
+	default:
+		return nil, fmt.Errorf("unsupported format %q (expected %s, %s or %s)", format, FormatTOML, FormatYAML, FormatJSON)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", format, err)
+	}
+	if cfg == nil {
+		cfg = make(KasherConfig)
+	}
+	return cfg, nil
+}
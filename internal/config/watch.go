@@ -0,0 +1,81 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// WatchDigest fingerprints the files matched by the task's WatchFiles globs: their
+// paths, modification times and contents. A cached entry whose digest differs from the
+// current one is stale. Relative globs are resolved against the task's working
+// directory. It returns an empty string if the task watches no files.
+func (t TaskConfig) WatchDigest() (string, error) {
+	if len(t.WatchFiles) == 0 {
+		return "", nil
+	}
+	baseDir := t.WorkDir()
+	if baseDir == "" {
+		var err error
+		if baseDir, err = os.Getwd(); err != nil {
+			return "", err
+		}
+	}
+
+	var paths []string
+	for _, pattern := range t.WatchFiles {
+		pattern = expandHome(pattern)
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(baseDir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return "", fmt.Errorf("invalid watchFiles pattern %q: %w", pattern, err)
+		}
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+
+	digest := sha256.New()
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		fmt.Fprintf(digest, "%s\x00%d\x00%d\x00", path, info.Size(), info.ModTime().UnixNano())
+		// A file that can't be read, like one that vanished since the glob, is part of
+		// the fingerprint rather than a reason to fail the run
+		if err := hashFile(digest, path); err != nil {
+			fmt.Fprintf(digest, "\x00unreadable\x00")
+		}
+	}
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
+
+// hashFile writes the contents of the file at path to w.
+func hashFile(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// expandHome replaces a leading ~/ in path with the user's home directory.
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}